@@ -0,0 +1,136 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Checksums contains the hex encoded checksums of transferred content.
+type Checksums struct {
+	SHA256 string
+	MD5    string
+}
+
+// UploadResult describes a finished upload.
+type UploadResult struct {
+	ProjectFile *ProjectFile // The project file which has been uploaded
+	Size        int64        // Number of bytes which have been uploaded
+	Checksums                // Checksums of the uploaded content
+}
+
+// VerifyProjectFile downloads the project file specified by the fileID (e.g. 1044) and
+// compares it with the local copy, which is read from r. It returns true if both are equal.
+func VerifyProjectFile(e Executor, fileID string, r io.Reader) (bool, error) {
+	return VerifyProjectFileContext(context.Background(), e, fileID, r)
+}
+
+// VerifyProjectFileContext is like VerifyProjectFile but uses the given context for all requests.
+func VerifyProjectFileContext(ctx context.Context, e Executor, fileID string, r io.Reader) (bool, error) {
+	local := newContentHash()
+	if _, err := io.Copy(local, r); err != nil {
+		return false, err
+	}
+
+	f, err := GetProjectFileContext(ctx, e, fileID)
+	if err != nil {
+		return false, err
+	}
+	if f.Links == nil || f.Links.FileDownload.Href == "" {
+		return false, fmt.Errorf("project file %s has no download link", fileID)
+	}
+	result, err := DownloadFileToContext(ctx, e, f.Links.FileDownload.Href, ioutil.Discard)
+	if err != nil {
+		return false, err
+	}
+	return result.Size == local.Size() && result.Checksums == local.Checksums(), nil
+}
+
+// contentHash computes the checksums of the content while it is transferred
+type contentHash struct {
+	mu     sync.Mutex
+	sha256 hash.Hash
+	md5    hash.Hash
+	size   int64
+}
+
+func newContentHash() *contentHash {
+	return &contentHash{sha256: sha256.New(), md5: md5.New()}
+}
+
+// Write fullfills the io.Writer interface
+func (h *contentHash) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sha256.Write(p)
+	h.md5.Write(p)
+	h.size += int64(len(p))
+	return len(p), nil
+}
+
+// Reset starts from scratch, e.g. if a request is retried
+func (h *contentHash) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sha256.Reset()
+	h.md5.Reset()
+	h.size = 0
+}
+
+// Size returns the number of bytes written so far
+func (h *contentHash) Size() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.size
+}
+
+// Checksums returns the checksums of the content written so far
+func (h *contentHash) Checksums() Checksums {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return Checksums{
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+	}
+}
+
+// verifyChecksums compares the checksums with a strong ETag of the response, which is either
+// the MD5 or the SHA-256 of the content. If contentMD5 is set, the Content-MD5 header is
+// compared as well, which is only valid if the response body contains the full content.
+// Headers which do not contain a checksum are ignored.
+func verifyChecksums(header http.Header, c Checksums, url string, contentMD5 bool) error {
+	if etag := header.Get("ETag"); !strings.HasPrefix(etag, "W/") {
+		etag = strings.ToLower(strings.Trim(etag, `"`))
+		if _, err := hex.DecodeString(etag); err == nil {
+			switch {
+			case len(etag) == md5.Size*2 && etag != c.MD5:
+				return &ChecksumError{URL: url, Algorithm: "MD5", Expected: etag, Actual: c.MD5}
+			case len(etag) == sha256.Size*2 && etag != c.SHA256:
+				return &ChecksumError{URL: url, Algorithm: "SHA-256", Expected: etag, Actual: c.SHA256}
+			}
+		}
+	}
+
+	if value := header.Get("Content-MD5"); contentMD5 && value != "" {
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err == nil && hex.EncodeToString(sum) != c.MD5 {
+			return &ChecksumError{URL: url, Algorithm: "MD5", Expected: hex.EncodeToString(sum), Actual: c.MD5}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+// setHeader returns a middleware which sets the header of all responses to requests with the given method
+func setHeader(method, key, value string) rex.Middleware {
+	return func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Execute(req)
+			if err == nil && req.Method == method {
+				if value == "" {
+					resp.Header.Del(key)
+				} else {
+					resp.Header.Set(key, value)
+				}
+			}
+			return resp, err
+		})
+	}
+}
+
+func checksums(content string) rex.Checksums {
+	sha := sha256.Sum256([]byte(content))
+	sum := md5.Sum([]byte(content))
+	return rex.Checksums{SHA256: hex.EncodeToString(sha[:]), MD5: hex.EncodeToString(sum[:])}
+}
+
+func TestUploadChecksums(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "checksum")
+
+	content := strings.Repeat("v 0 0 0\n", 100)
+	result, err := rex.UploadProjectFileWithResult(c, p.ID, "model", "model.obj", nil, strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Size != int64(len(content)) || result.Checksums != checksums(content) {
+		t.Errorf("got size %d and checksums %+v, want %d and %+v", result.Size, result.Checksums, len(content), checksums(content))
+	}
+
+	// The ETag of the server does not match the uploaded content
+	e := rex.Chain(c, setHeader("POST", "ETag", `"`+checksums("other").MD5+`"`))
+	err = rex.ReplaceProjectFileContent(e, result.ProjectFile.ID, "model.obj", strings.NewReader(content))
+	var checksumErr *rex.ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Algorithm != "MD5" || checksumErr.Actual != checksums(content).MD5 {
+		t.Errorf("got error %v, want a MD5 ChecksumError", err)
+	}
+}
+
+func TestUploadResumableChecksums(t *testing.T) {
+	_, c := newResumableServer(t)
+	p := newTestProject(t, c, "checksum")
+
+	content := strings.Repeat("v 0 0 0\n", 12)
+	state := filepath.Join(t.TempDir(), "upload.json")
+	result, err := rex.UploadProjectFileResumableWithResult(c, p.ID, "model", "model.obj", nil, strings.NewReader(content), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Size != int64(len(content)) || result.Checksums != checksums(content) {
+		t.Errorf("got size %d and checksums %+v, want %d and %+v", result.Size, result.Checksums, len(content), checksums(content))
+	}
+}
+
+func TestDownloadChecksums(t *testing.T) {
+	_, c := newTestClient(t)
+	content := strings.Repeat("v 0 0 0\n", 100)
+	_, link := newDownloadProject(t, c, content)
+	want := checksums(content)
+	md5sum, _ := hex.DecodeString(checksums("other").MD5)
+
+	tests := []struct {
+		name      string
+		key       string
+		value     string
+		algorithm string // empty if the download is valid
+	}{
+		{"server", "", "", ""},
+		{"SHA-256 ETag", "ETag", `"` + want.SHA256 + `"`, ""},
+		{"weak ETag", "ETag", `W/"` + checksums("other").MD5 + `"`, ""},
+		{"opaque ETag", "ETag", `"v1"`, ""},
+		{"MD5 ETag mismatch", "ETag", `"` + checksums("other").MD5 + `"`, "MD5"},
+		{"SHA-256 ETag mismatch", "ETag", `"` + checksums("other").SHA256 + `"`, "SHA-256"},
+		{"Content-MD5 mismatch", "Content-MD5", base64.StdEncoding.EncodeToString(md5sum), "MD5"},
+	}
+	for _, tt := range tests {
+		e := rex.Executor(c)
+		if tt.key != "" {
+			e = rex.Chain(c, setHeader("GET", tt.key, tt.value))
+		}
+		var b bytes.Buffer
+		result, err := rex.DownloadFileTo(e, link, &b)
+
+		var checksumErr *rex.ChecksumError
+		if tt.algorithm != "" {
+			if !errors.As(err, &checksumErr) || checksumErr.Algorithm != tt.algorithm {
+				t.Errorf("%s: got error %v, want a %s ChecksumError", tt.name, err, tt.algorithm)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if result.Checksums != want || b.String() != content {
+			t.Errorf("%s: got checksums %+v, want %+v", tt.name, result.Checksums, want)
+		}
+	}
+}
+
+func TestVerifyProjectFile(t *testing.T) {
+	_, c := newTestClient(t)
+	content := strings.Repeat("v 0 0 0\n", 100)
+	fileID, _ := newDownloadProject(t, c, content)
+
+	tests := []struct {
+		local string
+		equal bool
+	}{
+		{content, true},
+		{content + "v 1 1 1\n", false},
+		{content[:len(content)-1], false},
+		{strings.Replace(content, "0", "1", 1), false},
+	}
+	for _, tt := range tests {
+		equal, err := rex.VerifyProjectFile(c, fileID, strings.NewReader(tt.local))
+		if err != nil || equal != tt.equal {
+			t.Errorf("local copy of %d bytes: got %v, %v, want %v", len(tt.local), equal, err, tt.equal)
+		}
+	}
+
+	if _, err := rex.VerifyProjectFile(c, "4711", strings.NewReader(content)); !rex.IsNotFound(err) {
+		t.Errorf("unknown file: got error %v, want not found", err)
+	}
+}
@@ -3,14 +3,17 @@
 package rex
 
 import (
+	"bytes"
+	"context"
 	b64 "encoding/base64"
 	"encoding/json"
-	"fmt"
 	"golang.org/x/oauth2"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Client stores all user relevant information. The client holds the
@@ -21,14 +24,22 @@ import (
 //     client :=  NewClient(nil)
 //     err := client.Login("<ClientId>", "<ClientSecret>")
 type Client struct {
-	User       *User        // Stores the user information
-	Token      oauth2.Token // Contains the authentication token
-	httpClient *http.Client // The actual net client
+	User        *User                    // Stores the user information
+	Token       oauth2.Token             // Initial authentication token, refreshed tokens are not stored here (see CurrentToken)
+	httpClient  *http.Client             // The actual net client
+	baseURL     string                   // REX base URL, RexBaseURL is used if empty
+	tokenSource *clientCredentialsSource // Refreshes the token before it expires (set by Login)
+	mu          sync.Mutex               // Protects Token and tokenSource while they are set by Login
 }
 
 // Executor is an interface which is used to perform the actual
 // REX request. This interface should be used for any REX API call.
 // The Client structure is implementing this interface and performs the actual call.
+//
+// The API calls take the REX base URL from the executor, if it implements BaseURLProvider.
+// Executors which wrap another executor must forward its base URL, otherwise the API calls
+// fail with ErrNoBaseURL. Use Chain or ExecutorWithBaseURL for wrapping executors.
+// Executors which do not implement BaseURLProvider at all talk to RexBaseURL.
 type Executor interface {
 	Execute(req *http.Request) (*http.Response, error)
 }
@@ -42,13 +53,91 @@ var (
 func (c *Client) Execute(req *http.Request) (*http.Response, error) {
 
 	req.Header.Add("accept", "application/json")
-	c.Token.SetAuthHeader(req)
+	token, err := c.token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	token.SetAuthHeader(req)
 	return c.httpClient.Do(req)
 }
 
+// getJSON performs a GET request on the link and decodes the JSON response into v
+func getJSON(ctx context.Context, e Executor, link string, v interface{}) error {
+	req, _ := http.NewRequestWithContext(ctx, "GET", link, nil)
+
+	resp, err := e.Execute(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// patchJSON sends the body as PATCH request to the link and decodes the JSON response into v
+func patchJSON(ctx context.Context, e Executor, link string, body interface{}, v interface{}) error {
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(body)
+
+	req, _ := http.NewRequestWithContext(ctx, "PATCH", link, b)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := e.Execute(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	if err = checkResponse(resp, http.StatusOK, http.StatusNoContent); err != nil {
+		return err
+	}
+
+	// The server only returns the updated resource if requested, fetch it otherwise
+	if resp.StatusCode == http.StatusNoContent {
+		return getJSON(ctx, e, link, v)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// CurrentToken returns the authentication token which is used for the next request. If the
+// client has been logged in using Login, the token is refreshed if it is about to expire.
+func (c *Client) CurrentToken() (*oauth2.Token, error) {
+	return c.token(context.Background())
+}
+
+// token returns a valid authentication token. If the client has been logged in
+// using Login, a new token is fetched automatically shortly before the current one expires.
+// The refresh uses ctx, hence it is aborted together with the request.
+func (c *Client) token(ctx context.Context) (*oauth2.Token, error) {
+	c.mu.Lock()
+	src, token := c.tokenSource, c.Token
+	c.mu.Unlock()
+
+	if src == nil {
+		return &token, nil
+	}
+	return src.TokenContext(ctx)
+}
+
+// ClientOption configures optional settings of a Client
+type ClientOption func(*Client)
+
+// WithBaseURL sets the REX base URL (e.g. https://rex.robotic-eyes.com) for the client.
+// If not set, the global RexBaseURL is used.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
 // NewClient creates a new client instance
 //
-func NewClient(httpClient *http.Client) *Client {
+func NewClient(httpClient *http.Client, opts ...ClientOption) *Client {
 
 	if httpClient == nil {
 		httpClient = http.DefaultClient
@@ -56,14 +145,25 @@ func NewClient(httpClient *http.Client) *Client {
 	c := &Client{
 		httpClient: httpClient,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
 	return c
 }
 
+// BaseURL returns the REX base URL which is used by the client
+func (c *Client) BaseURL() string {
+	if c.baseURL == "" {
+		return RexBaseURL
+	}
+	return c.baseURL
+}
+
 // NewClientWithToken takes token and reads the user information.
 // If the token is not valid anymore, an error will be returned,
 // else a new client will be provided.
-func NewClientWithToken(token oauth2.Token, httpClient *http.Client) (*Client, error) {
-	c := NewClient(httpClient)
+func NewClientWithToken(token oauth2.Token, httpClient *http.Client, opts ...ClientOption) (*Client, error) {
+	c := NewClient(httpClient, opts...)
 	c.Token = token
 
 	var err error
@@ -71,21 +171,78 @@ func NewClientWithToken(token oauth2.Token, httpClient *http.Client) (*Client, e
 	return c, err
 }
 
-// Login uses the user's authentication information and gets a new authentication token
+// Login uses the user's authentication information and gets a new authentication token.
+//
+// The clientID and clientSecret are kept by the client, so that a new token can be
+// fetched automatically as soon as the current one is about to expire.
 func (c *Client) Login(clientID, clientSecret string) error {
+	return c.LoginContext(context.Background(), clientID, clientSecret)
+}
 
-	err := c.fetchToken(clientID, clientSecret)
+// LoginContext is like Login but uses the given context for fetching the initial token
+// and the user information. Tokens which are refreshed later on use the context of the
+// request which triggers the refresh.
+func (c *Client) LoginContext(ctx context.Context, clientID, clientSecret string) error {
+
+	token, err := c.fetchToken(ctx, clientID, clientSecret)
 	if err != nil {
 		return err
 	}
 
-	c.User, err = GetCurrentUser(c)
+	c.mu.Lock()
+	c.Token = *token
+	c.tokenSource = newClientCredentialsSource(c, clientID, clientSecret, token)
+	c.mu.Unlock()
+
+	c.User, err = GetCurrentUserContext(ctx, c)
 	return err
 }
 
-func (c *Client) fetchToken(clientID, clientSecret string) error {
+// clientCredentialsSource reuses a token as long as it is valid and fetches a new token
+// using the client credentials grant shortly before it expires. Concurrent refreshes are
+// serialized, hence only a single new token is fetched.
+type clientCredentialsSource struct {
+	client       *Client
+	clientID     string
+	clientSecret string
+	sem          chan struct{} // Held while the token is read or refreshed
+	token        *oauth2.Token
+}
+
+func newClientCredentialsSource(c *Client, clientID, clientSecret string, token *oauth2.Token) *clientCredentialsSource {
+	return &clientCredentialsSource{client: c, clientID: clientID, clientSecret: clientSecret, sem: make(chan struct{}, 1), token: token}
+}
+
+// Token fullfills the oauth2.TokenSource interface
+func (s *clientCredentialsSource) Token() (*oauth2.Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+// TokenContext is like Token, but uses ctx for the refresh. Waiting for a refresh of
+// another request is aborted as well if ctx is done.
+func (s *clientCredentialsSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.sem }()
+
+	// Valid reports false shortly before the expiry
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	token, err := s.client.fetchToken(ctx, s.clientID, s.clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+func (c *Client) fetchToken(ctx context.Context, clientID, clientSecret string) (*oauth2.Token, error) {
 
-	req, _ := http.NewRequest("POST", RexBaseURL+apiAuth, strings.NewReader("grant_type=client_credentials"))
+	req, _ := http.NewRequestWithContext(ctx, "POST", c.BaseURL()+apiAuth, strings.NewReader("grant_type=client_credentials"))
 
 	token := clientID + ":" + clientSecret
 	encodedToken := b64.StdEncoding.EncodeToString([]byte(token))
@@ -95,19 +252,23 @@ func (c *Client) fetchToken(clientID, clientSecret string) error {
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 	}()
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
 	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("Server did not respond properly")
+	var result oauth2.Token
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
 	}
 
-	return json.Unmarshal(body, &c.Token)
+	// The expiry is not part of the response, it has to be computed from expires_in
+	if result.ExpiresIn > 0 {
+		result.Expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return &result, nil
 }
@@ -0,0 +1,99 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/breiting/rex"
+	"github.com/breiting/rex/rextest"
+)
+
+func TestLoginSetsExpiry(t *testing.T) {
+	before := time.Now()
+	s, c := newTestClient(t)
+	if c.Token.Expiry.Before(before.Add(s.TokenLifetime-time.Minute)) || c.Token.Expiry.After(time.Now().Add(s.TokenLifetime)) {
+		t.Errorf("expiry %v does not match the token lifetime %v", c.Token.Expiry, s.TokenLifetime)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	// Tokens expiring within 10 seconds are refreshed before every request
+	_, c := newTestClient(t, func(s *rextest.Server) { s.TokenLifetime = 2 * time.Second })
+	initial := c.Token.AccessToken
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rex.GetCurrentUser(c); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	token, err := c.CurrentToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == initial {
+		t.Error("token has not been refreshed")
+	}
+	if c.Token.AccessToken != initial {
+		t.Error("initial token has been overwritten")
+	}
+}
+
+// roundTripperFunc is an adapter to allow the use of ordinary functions as http.RoundTripper
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTokenRefreshContext(t *testing.T) {
+	s := rextest.NewServer()
+	t.Cleanup(s.Close)
+	s.TokenLifetime = 2 * time.Second
+
+	// Once hang is set, the token endpoint does not answer until the request is canceled
+	var hang atomic.Bool
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	transport := s.Client().Transport
+	httpClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if hang.Load() && req.URL.Path == "/oauth/token" {
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-release:
+			}
+		}
+		return transport.RoundTrip(req)
+	})}
+
+	c := rex.NewClient(httpClient, rex.WithBaseURL(s.URL))
+	if err := c.Login(rextest.ClientID, rextest.ClientSecret); err != nil {
+		t.Fatal(err)
+	}
+	hang.Store(true)
+
+	// The token expires within 10 seconds, hence the request has to refresh it
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := rex.GetCurrentUserContext(ctx, c); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request returned after %v, want it to be canceled together with the refresh", elapsed)
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// partSuffix is appended to the file name as long as a download is incomplete
+const partSuffix = ".part"
+
+// validatorSuffix is appended to the file name of the file which stores the validator (ETag or
+// Last-Modified) of an incomplete download
+const validatorSuffix = ".part.validator"
+
+// DownloadResult describes a finished download.
+type DownloadResult struct {
+	FileName    string // File name as announced by the server (content-disposition)
+	Path        string // Path of the written file, only set if the file has been stored on disk
+	ContentType string // Content type as sent by the server
+	Offset      int64  // Position of the first transferred byte, only set for ranged or resumed downloads
+	Size        int64  // Number of bytes which have been transferred
+	TotalSize   int64  // Size of the complete file, -1 if unknown
+	Checksums          // Checksums of the complete file, or of the range for DownloadRange
+}
+
+// DownloadFileTo downloads a given link (e.g. project file link) and writes the content to w.
+//
+// If the server reports a checksum (ETag or Content-MD5) which does not match the content,
+// a ChecksumError is returned.
+func DownloadFileTo(e Executor, link string, w io.Writer) (*DownloadResult, error) {
+	return DownloadFileToContext(context.Background(), e, link, w)
+}
+
+// DownloadFileToContext is like DownloadFileTo but uses the given context for the request.
+// Cancelling the context aborts a running download.
+func DownloadFileToContext(ctx context.Context, e Executor, link string, w io.Writer) (*DownloadResult, error) {
+	resp, err := openDownload(e, newDownloadRequest(ctx, "GET", link), http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	h := newContentHash()
+	result := newDownloadResult(resp)
+	result.Size, err = io.Copy(io.MultiWriter(w, h), newProgressReader(ctx, resp.Body, 0, result.TotalSize))
+	if err != nil {
+		return result, err
+	}
+	result.Checksums = h.Checksums()
+	return result, verifyChecksums(resp.Header, result.Checksums, link, true)
+}
+
+// DownloadFileToDir downloads a given link (e.g. project file link) into the directory dir.
+//
+// The file name is anticipated by the provided information from the server using the
+// content-disposition, which is requested using a HEAD request (or the GET request of the
+// download, if the HEAD request fails). The content is written to
+// a .part file first, which is renamed as soon as the download is complete. If the download
+// fails, the .part file is kept and the next call resumes the download.
+//
+// A download is only resumed if the server confirms that the file has not been changed since
+// the partial download (If-Range). For this purpose, the ETag or Last-Modified header of the
+// server is stored in a .part.validator file next to the .part file.
+//
+// If the server reports a checksum (ETag or Content-MD5) which does not match the downloaded
+// file, the file is removed and a ChecksumError is returned.
+func DownloadFileToDir(e Executor, link string, dir string) (*DownloadResult, error) {
+	return DownloadFileToDirContext(context.Background(), e, link, dir)
+}
+
+// DownloadFileToDirContext is like DownloadFileToDir but uses the given context for all requests.
+// Cancelling the context aborts a running download.
+func DownloadFileToDirContext(ctx context.Context, e Executor, link string, dir string) (*DownloadResult, error) {
+	resp, err := e.Execute(newDownloadRequest(ctx, "HEAD", link))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	fileName := fileNameFromResponse(resp)
+
+	// The server does not support HEAD (e.g. 405, or 403 for links which are signed for GET only),
+	// hence the file name is taken from a GET request, whose response is used for the download
+	// unless there is a partial download to resume. Errors are reported using the GET response.
+	var download *http.Response
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		download, err = openDownload(e, newDownloadRequest(ctx, "GET", link), http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		defer download.Body.Close()
+		fileName = fileNameFromResponse(download)
+	}
+
+	path := filepath.Join(dir, fileName)
+	if filepath.Dir(path) != filepath.Clean(dir) {
+		return nil, fmt.Errorf("invalid file name %q", fileName)
+	}
+	return downloadToFile(ctx, e, link, path, download)
+}
+
+// DownloadFileToPath downloads a given link (e.g. project file link) into the file path.
+// Like DownloadFileToDir, the download is resumed if a .part file of a previous download exists.
+func DownloadFileToPath(e Executor, link string, path string) (*DownloadResult, error) {
+	return DownloadFileToPathContext(context.Background(), e, link, path)
+}
+
+// DownloadFileToPathContext is like DownloadFileToPath but uses the given context for all requests.
+// Cancelling the context aborts a running download.
+func DownloadFileToPathContext(ctx context.Context, e Executor, link string, path string) (*DownloadResult, error) {
+	return downloadToFile(ctx, e, link, path, nil)
+}
+
+// DownloadRange downloads length bytes starting at offset of a given link (e.g. project file link)
+// and writes them to w. If length is not positive, everything up to the end of the file is downloaded.
+//
+// If the server does not support range requests, the bytes before offset are skipped.
+func DownloadRange(e Executor, link string, offset, length int64, w io.Writer) (*DownloadResult, error) {
+	return DownloadRangeContext(context.Background(), e, link, offset, length, w)
+}
+
+// DownloadRangeContext is like DownloadRange but uses the given context for the request.
+// Cancelling the context aborts a running download.
+func DownloadRangeContext(ctx context.Context, e Executor, link string, offset, length int64, w io.Writer) (*DownloadResult, error) {
+	req := newDownloadRequest(ctx, "GET", link)
+	if length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := openDownload(e, req, http.StatusOK, http.StatusPartialContent)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := newDownloadResult(resp)
+	if resp.StatusCode == http.StatusOK {
+		if _, err = io.CopyN(ioutil.Discard, resp.Body, offset); err != nil {
+			return nil, err
+		}
+		result.Offset = offset
+	}
+
+	var r io.Reader = resp.Body
+	total := result.TotalSize
+	if total > 0 {
+		total -= offset
+	}
+	if length > 0 {
+		r = io.LimitReader(resp.Body, length)
+		total = length
+	}
+	h := newContentHash()
+	result.Size, err = io.Copy(io.MultiWriter(w, h), newProgressReader(ctx, r, 0, total))
+	result.Checksums = h.Checksums()
+	return result, err
+}
+
+// downloadToFile downloads the link into path. An existing .part file is resumed using a range
+// request, if the validator of the partial download is known. resp is the response of a previous
+// request for the whole file, which is used if there is nothing to resume (it may be nil).
+func downloadToFile(ctx context.Context, e Executor, link string, path string, resp *http.Response) (*DownloadResult, error) {
+	part := path + partSuffix
+
+	var offset int64
+	validator, _ := ioutil.ReadFile(path + validatorSuffix)
+	info, err := os.Stat(part)
+	if err == nil && len(validator) > 0 {
+		offset = info.Size()
+	}
+
+	if resp == nil || offset > 0 {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		req := newDownloadRequest(ctx, "GET", link)
+		if offset > 0 {
+			// The server sends the whole file if it has been changed after the partial download
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+			req.Header.Set("If-Range", string(validator))
+		}
+		resp, err = openDownload(e, req, http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+	}
+
+	result := newDownloadResult(resp)
+	result.Path = path
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Either nothing to resume, the file has been changed or the server does not support ranges
+		offset = 0
+		if err = saveValidator(path, resp.Header); err != nil {
+			return nil, err
+		}
+	case http.StatusPartialContent:
+		if result.Offset != offset {
+			return nil, fmt.Errorf("cannot resume download of %s: server sent range starting at %d instead of %d", link, result.Offset, offset)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		if result.TotalSize != offset {
+			// The partial file is larger than the file on the server, start from scratch
+			if err = removePart(path); err != nil {
+				return nil, err
+			}
+			return downloadToFile(ctx, e, link, path, nil)
+		}
+
+		// The previous download has been complete, but not renamed
+		result.Offset = offset
+		if result.Checksums, err = fileChecksums(part); err != nil {
+			return nil, err
+		}
+		return result, finishPart(path)
+	}
+
+	// The checksums cover the whole file, including the part which has been downloaded before
+	h := newContentHash()
+	flag := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if offset == 0 {
+		flag |= os.O_TRUNC
+	}
+	output, err := os.OpenFile(part, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		_, err = io.Copy(h, io.NewSectionReader(output, 0, offset))
+	}
+	if err == nil {
+		result.Size, err = io.Copy(io.MultiWriter(output, h), newProgressReader(ctx, resp.Body, offset, result.TotalSize))
+	}
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Checksums = h.Checksums()
+	if err = verifyChecksums(resp.Header, result.Checksums, link, resp.StatusCode == http.StatusOK); err != nil {
+		removePart(path)
+		return nil, err
+	}
+	return result, finishPart(path)
+}
+
+// saveValidator stores the validator of the response, which is used for resuming the download
+// of path. A strong ETag is preferred over Last-Modified. If the response does not contain a
+// validator, the download cannot be resumed.
+func saveValidator(path string, header http.Header) error {
+	validator := header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = header.Get("Last-Modified")
+	}
+	if validator == "" {
+		return removeFile(path + validatorSuffix)
+	}
+	return ioutil.WriteFile(path+validatorSuffix, []byte(validator), 0666)
+}
+
+// finishPart renames the .part file of a complete download and removes its validator
+func finishPart(path string) error {
+	if err := os.Rename(path+partSuffix, path); err != nil {
+		return err
+	}
+	return removeFile(path + validatorSuffix)
+}
+
+// removePart removes the .part file of a download and its validator
+func removePart(path string) error {
+	if err := removeFile(path + partSuffix); err != nil {
+		return err
+	}
+	return removeFile(path + validatorSuffix)
+}
+
+// removeFile removes the file, a file which does not exist is not an error
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// fileChecksums computes the checksums of the content of a local file
+func fileChecksums(path string) (Checksums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Checksums{}, err
+	}
+	defer f.Close()
+
+	h := newContentHash()
+	_, err = io.Copy(h, f)
+	return h.Checksums(), err
+}
+
+// newDownloadRequest creates the request (GET or HEAD) for downloading the given link
+func newDownloadRequest(ctx context.Context, method string, link string) *http.Request {
+	req, _ := http.NewRequestWithContext(ctx, method, link, nil)
+
+	// Set content disposition in order to get information about the filename
+	req.Header.Add("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	return req
+}
+
+// openDownload executes the request and checks the response status
+func openDownload(e Executor, req *http.Request, expected ...int) (*http.Response, error) {
+	resp, err := e.Execute(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkResponse(resp, expected...); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// newDownloadResult creates the result using the response headers
+func newDownloadResult(resp *http.Response) *DownloadResult {
+	result := &DownloadResult{
+		FileName:    fileNameFromResponse(resp),
+		ContentType: resp.Header.Get("Content-Type"),
+		TotalSize:   resp.ContentLength,
+	}
+	if contentRange := resp.Header.Get("Content-Range"); contentRange != "" {
+		result.Offset, result.TotalSize = parseContentRange(contentRange)
+	}
+	return result
+}
+
+// parseContentRange returns the start and the total size of a content range such as
+// "bytes 0-99/1000" or "bytes */1000". The total size is -1 if it is unknown.
+func parseContentRange(contentRange string) (start, total int64) {
+	total = -1
+	var byteRange, size string
+	if n, _ := fmt.Sscanf(contentRange, "bytes %s", &byteRange); n != 1 {
+		return 0, total
+	}
+	if i := strings.Index(byteRange, "/"); i >= 0 {
+		byteRange, size = byteRange[:i], byteRange[i+1:]
+	}
+	if v, err := strconv.ParseInt(size, 10, 64); err == nil {
+		total = v
+	}
+	if i := strings.Index(byteRange, "-"); i >= 0 {
+		start, _ = strconv.ParseInt(byteRange[:i], 10, 64)
+	}
+	return start, total
+}
+
+// fileNameFromResponse returns the sanitized file name of the content-disposition header,
+// or default.dat if the server did not send a usable file name.
+//
+// The extended filename* parameter (RFC 5987) is preferred over filename.
+func fileNameFromResponse(resp *http.Response) string {
+	contentInfo := resp.Header.Get("Content-Disposition")
+
+	var fileName string
+	if _, params, err := mime.ParseMediaType(contentInfo); err == nil {
+		fileName = params["filename"]
+	} else {
+		// The header is not RFC compliant, fall back to a lenient match
+		re, _ := regexp.Compile("filename=\"(.*)\"")
+		values := re.FindStringSubmatch(contentInfo)
+		if len(values) > 0 {
+			fileName = values[1]
+		}
+	}
+
+	fileName = sanitizeFileName(fileName)
+	if fileName == "" {
+		fileName = "default.dat"
+	}
+	return fileName
+}
+
+// sanitizeFileName removes all directories as well as control characters from the
+// file name sent by the server, hence the file cannot be written outside the target directory
+func sanitizeFileName(name string) string {
+	if i := strings.LastIndexAny(name, "/\\"); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == ':' {
+			return -1
+		}
+		return r
+	}, name)
+
+	// Avoid hidden files as well as . and ..
+	return strings.TrimSpace(strings.TrimLeft(name, ". "))
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFileNameFromResponse(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{``, "default.dat"},
+		{`attachment; filename="model.rex"`, "model.rex"},
+		{`attachment; filename=model.rex`, "model.rex"},
+
+		// Path traversal
+		{`attachment; filename="../../etc/x"`, "x"},
+		{`attachment; filename="/etc/passwd"`, "passwd"},
+		{`attachment; filename="C:\\Windows\\evil.exe"`, "evil.exe"},
+		{`attachment; filename="..\\..\\x.rex"`, "x.rex"},
+		{`attachment; filename*=UTF-8''..%2F..%2Fetc%2Fx`, "x"},
+		{`attachment; filename*=UTF-8''..%5C..%5Cx.rex`, "x.rex"},
+		{`attachment; filename="C:x.rex"`, "Cx.rex"},
+
+		// RFC 5987 encoding
+		{`attachment; filename*=UTF-8''%C3%A4rger.rex`, "ärger.rex"},
+		{`attachment; filename="fallback.rex"; filename*=UTF-8''%C3%BCber.rex`, "über.rex"},
+
+		// Hidden files and control characters
+		{`attachment; filename=".bashrc"`, "bashrc"},
+		{`attachment; filename=" . .profile"`, "profile"},
+		{`attachment; filename=".."`, "default.dat"},
+		{`attachment; filename="..."`, "default.dat"},
+		{`attachment; filename*=UTF-8''a%0Ab%09c%00.rex`, "abc.rex"},
+		{`attachment; filename*=UTF-8''%0A%0D`, "default.dat"},
+
+		// Malformed headers are matched by the fallback
+		{`attachment; filename="model.rex"; broken`, "model.rex"},
+		{`attachment; filename="../../etc/x"; =`, "x"},
+		{`attachment; filename="dir/.hidden"; broken`, "hidden"},
+		{`attachment; broken`, "default.dat"},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Content-Disposition", tt.header)
+		}
+		if got := fileNameFromResponse(resp); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
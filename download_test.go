@@ -0,0 +1,330 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/breiting/rex"
+)
+
+// recorder records all requests, the body of a GET response can be cut off after a number of bytes
+type recorder struct {
+	requests []*http.Request
+	cutOff   int64 // cut off the body of the next GET response after this number of bytes, if > 0
+}
+
+func (r *recorder) middleware(next rex.Executor) rex.Executor {
+	return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+		r.requests = append(r.requests, req)
+		resp, err := next.Execute(req)
+		if err == nil && req.Method == "GET" && r.cutOff > 0 {
+			resp.Body = brokenBody{io.MultiReader(io.LimitReader(resp.Body, r.cutOff), brokenBody{}), resp.Body}
+			r.cutOff = 0
+		}
+		return resp, err
+	})
+}
+
+// count returns the number of requests with the given method
+func (r *recorder) count(method string) int {
+	var n int
+	for _, req := range r.requests {
+		if req.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// brokenBody is a response body which fails after its reader is exhausted
+type brokenBody struct {
+	io.Reader
+	io.Closer
+}
+
+func (b brokenBody) Read(p []byte) (int, error) {
+	if b.Reader == nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return b.Reader.Read(p)
+}
+
+// newDownloadProject creates a project with a single file, the download link of the file is returned
+func newDownloadProject(t *testing.T, c *rex.Client, content string) (fileID, link string) {
+	t.Helper()
+	p := newTestProject(t, c, "download")
+	result, err := rex.UploadProjectFileWithResult(c, p.ID, "model", "model.obj", nil, strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.ProjectFile.ID, result.ProjectFile.Links.FileDownload.Href
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func assertNotExist(t *testing.T, paths ...string) {
+	t.Helper()
+	for _, path := range paths {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s has not been removed", path)
+		}
+	}
+}
+
+func TestDownloadFileToDirTraversal(t *testing.T) {
+	headers := []string{
+		`attachment; filename="../../escaped.rex"`,
+		`attachment; filename*=UTF-8''..%2F..%2Fescaped.rex`,
+		`attachment; filename="..\\..\\escaped.rex"`,
+		`attachment; filename="../../escaped.rex"; broken`,
+	}
+	for _, header := range headers {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Disposition", header)
+			w.Write([]byte("REX1"))
+		}))
+
+		root := t.TempDir()
+		dir := filepath.Join(root, "a", "b")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		result, err := rex.DownloadFileToDir(rex.NewClient(ts.Client()), ts.URL+"/file", dir)
+		ts.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", header, err)
+		}
+
+		if want := filepath.Join(dir, "escaped.rex"); result.Path != want {
+			t.Errorf("%s: got path %s, want %s", header, result.Path, want)
+		}
+		for _, outside := range []string{filepath.Join(root, "escaped.rex"), filepath.Join(root, "a", "escaped.rex")} {
+			if _, err := os.Stat(outside); err == nil {
+				t.Errorf("%s: file has been written to %s", header, outside)
+			}
+		}
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	_, c := newTestClient(t)
+	content := strings.Repeat("v 0 0 0\n", 12)
+	_, link := newDownloadProject(t, c, content)
+
+	rec := &recorder{cutOff: 40}
+	e := rex.Chain(c, rec.middleware)
+	path := filepath.Join(t.TempDir(), "model.obj")
+	if _, err := rex.DownloadFileToPath(e, link, path); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+	if got := readFile(t, path+".part"); got != content[:40] {
+		t.Fatalf("got partial content %q", got)
+	}
+
+	rec.requests = nil
+	result, err := rex.DownloadFileToPath(e, link, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Offset != 40 || result.Size != int64(len(content)-40) || result.TotalSize != int64(len(content)) {
+		t.Errorf("got offset %d, size %d and total size %d", result.Offset, result.Size, result.TotalSize)
+	}
+	if got := readFile(t, path); got != content {
+		t.Errorf("got content %q, want %q", got, content)
+	}
+	assertNotExist(t, path+".part", path+".part.validator")
+
+	req := rec.requests[0]
+	if req.Header.Get("Range") != "bytes=40-" || !strings.HasPrefix(req.Header.Get("If-Range"), `"`) {
+		t.Errorf("resumed with Range %q and If-Range %q, want the ETag", req.Header.Get("Range"), req.Header.Get("If-Range"))
+	}
+	if req.Header.Get("If-Unmodified-Since") != "" {
+		t.Error("download has been resumed using the local modification time")
+	}
+}
+
+func TestDownloadResumeChangedFile(t *testing.T) {
+	_, c := newTestClient(t)
+	fileID, link := newDownloadProject(t, c, strings.Repeat("v 0 0 0\n", 12))
+
+	rec := &recorder{cutOff: 40}
+	e := rex.Chain(c, rec.middleware)
+	path := filepath.Join(t.TempDir(), "model.obj")
+	if _, err := rex.DownloadFileToPath(e, link, path); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+
+	// The file is changed on the server, but the clock of the client is ahead of the server
+	changed := strings.Repeat("v 1 1 1\n", 12)
+	if err := rex.ReplaceProjectFileContent(c, fileID, "model.obj", strings.NewReader(changed)); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(24 * time.Hour)
+	if err := os.Chtimes(path+".part", future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rex.DownloadFileToPath(e, link, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Offset != 0 || result.Size != int64(len(changed)) {
+		t.Errorf("got offset %d and size %d, want the whole file", result.Offset, result.Size)
+	}
+	if got := readFile(t, path); got != changed {
+		t.Errorf("got content %q, want %q", got, changed)
+	}
+}
+
+func TestDownloadPartWithoutValidator(t *testing.T) {
+	_, c := newTestClient(t)
+	content := strings.Repeat("v 0 0 0\n", 12)
+	_, link := newDownloadProject(t, c, content)
+
+	path := filepath.Join(t.TempDir(), "model.obj")
+	if err := ioutil.WriteFile(path+".part", []byte("garbage"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recorder{}
+	if _, err := rex.DownloadFileToPath(rex.Chain(c, rec.middleware), link, path); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != content {
+		t.Errorf("got content %q, want %q", got, content)
+	}
+	if rec.requests[0].Header.Get("Range") != "" {
+		t.Error("download without validator has been resumed")
+	}
+}
+
+func TestDownloadFileToDirRequests(t *testing.T) {
+	_, c := newTestClient(t)
+	content := strings.Repeat("v 0 0 0\n", 12)
+	_, link := newDownloadProject(t, c, content)
+
+	dir := t.TempDir()
+	rec := &recorder{cutOff: 10}
+	e := rex.Chain(c, rec.middleware)
+	if _, err := rex.DownloadFileToDir(e, link, dir); err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+
+	rec.requests = nil
+	result, err := rex.DownloadFileToDir(e, link, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Offset != 10 || readFile(t, filepath.Join(dir, "model.obj")) != content {
+		t.Errorf("download has not been resumed correctly, offset %d", result.Offset)
+	}
+	if rec.count("HEAD") != 1 || rec.count("GET") != 1 {
+		t.Errorf("got %d HEAD and %d GET requests, want one of each", rec.count("HEAD"), rec.count("GET"))
+	}
+}
+
+func TestDownloadFileToDirWithoutHead(t *testing.T) {
+	for _, status := range []int{http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusForbidden, http.StatusNotFound} {
+		var gets int
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" {
+				w.WriteHeader(status)
+				return
+			}
+			gets++
+			w.Header().Set("Content-Disposition", `attachment; filename="model.rex"`)
+			w.Write([]byte("REX1"))
+		}))
+
+		dir := t.TempDir()
+		if _, err := rex.DownloadFileToDir(rex.NewClient(ts.Client()), ts.URL, dir); err != nil {
+			t.Errorf("HEAD status %d: %v", status, err)
+		}
+		ts.Close()
+		if gets != 1 {
+			t.Errorf("HEAD status %d: got %d GET requests, want 1", status, gets)
+		}
+		if got := readFile(t, filepath.Join(dir, "model.rex")); got != "REX1" {
+			t.Errorf("HEAD status %d: got content %q", status, got)
+		}
+	}
+}
+
+func TestDownloadFileToDirNotFound(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	// The error of the GET request is returned
+	var apiErr *rex.APIError
+	_, err := rex.DownloadFileToDir(rex.NewClient(ts.Client()), ts.URL, t.TempDir())
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("got error %v, want status 404", err)
+	}
+}
+
+func TestDownloadRange(t *testing.T) {
+	_, c := newTestClient(t)
+	content := "v 0 0 0\nv 1 1 1\nv 2 2 2\n"
+	_, link := newDownloadProject(t, c, content)
+
+	tests := []struct {
+		offset, length int64
+		want           string
+	}{
+		{0, 8, "v 0 0 0\n"},
+		{8, 8, "v 1 1 1\n"},
+		{16, 0, "v 2 2 2\n"},
+		{20, -1, "2 2\n"},
+		{0, 0, content},
+		{22, 100, "2\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		result, err := rex.DownloadRange(c, link, tt.offset, tt.length, &b)
+		if err != nil {
+			t.Errorf("offset %d, length %d: %v", tt.offset, tt.length, err)
+			continue
+		}
+		if b.String() != tt.want || result.Size != int64(len(tt.want)) || result.TotalSize != int64(len(content)) {
+			t.Errorf("offset %d, length %d: got %q with size %d of %d, want %q", tt.offset, tt.length, b.String(), result.Size, result.TotalSize, tt.want)
+		}
+	}
+
+	if _, err := rex.DownloadRange(c, link, int64(len(content)), 0, ioutil.Discard); err == nil {
+		t.Error("range beyond the end of the file has been downloaded")
+	}
+}
+
+func TestDownloadRangeWithoutRangeSupport(t *testing.T) {
+	content := "v 0 0 0\nv 1 1 1\nv 2 2 2\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer ts.Close()
+
+	var b bytes.Buffer
+	result, err := rex.DownloadRange(rex.NewClient(ts.Client()), ts.URL, 8, 8, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "v 1 1 1\n" || result.Offset != 8 {
+		t.Errorf("got %q at offset %d, want the skipped bytes to be dropped", b.String(), result.Offset)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ErrUserNotFound is returned if a user cannot be found, e.g. by GetUserByEmail.
+var ErrUserNotFound = errors.New("user not found")
+
+// APIError is returned whenever the REX API responds with an unexpected status code.
+//
+// Besides the raw response body, the error details which are sent by the REX server
+// (Spring/HAL error format) are stored in the error.
+type APIError struct {
+	StatusCode int    // HTTP status code of the response
+	Method     string // HTTP method of the request
+	URL        string // URL of the request
+	Body       []byte // Raw response body
+
+	Message   string // Error message sent by the server (message)
+	Reason    string // Short error description sent by the server (error), e.g. "Not Found"
+	Path      string // Request path reported by the server (path)
+	Timestamp string // Time when the error occurred as reported by the server (timestamp)
+}
+
+// Error fullfills the error interface
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Reason
+	}
+	if msg == "" {
+		msg = strings.TrimSpace(string(e.Body))
+	}
+	return fmt.Sprintf("%s %s: got server status %d with error: %s", e.Method, e.URL, e.StatusCode, msg)
+}
+
+// RollbackError is returned if an operation consisting of several requests failed,
+// and removing the resources which have already been created failed as well.
+type RollbackError struct {
+	Err         error // The error which caused the rollback
+	RollbackErr error // The error which occurred during the rollback
+}
+
+// Error fullfills the error interface
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%v (rollback failed: %v)", e.Err, e.RollbackErr)
+}
+
+// Unwrap returns both errors, hence errors.Is and errors.As check both of them
+func (e *RollbackError) Unwrap() []error {
+	return []error{e.Err, e.RollbackErr}
+}
+
+// ChecksumError is returned if the checksum of transferred content does not match the
+// checksum reported by the server.
+type ChecksumError struct {
+	URL       string // URL of the request
+	Algorithm string // MD5 or SHA-256
+	Expected  string // Checksum reported by the server (hex)
+	Actual    string // Checksum of the transferred content (hex)
+}
+
+// Error fullfills the error interface
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s: %s checksum mismatch, expected %s but got %s", e.URL, e.Algorithm, e.Expected, e.Actual)
+}
+
+// IsNotFound returns true if err is an APIError with status 404 (Not Found).
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized returns true if err is an APIError with status 401 (Unauthorized).
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden returns true if err is an APIError with status 403 (Forbidden).
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+func hasStatus(err error, status int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == status
+}
+
+// checkResponse returns an APIError if the response status is not one of the expected
+// status codes. If no status code is given, every 2xx status is accepted.
+//
+// In case of an error, the response body is consumed.
+func checkResponse(resp *http.Response, expected ...int) error {
+	if len(expected) == 0 && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.URL = resp.Request.URL.String()
+	}
+	apiErr.Body, _ = ioutil.ReadAll(resp.Body)
+
+	var details struct {
+		Message   string          `json:"message"`
+		Error     string          `json:"error"`
+		Path      string          `json:"path"`
+		Timestamp json.RawMessage `json:"timestamp"`
+	}
+	if json.Unmarshal(apiErr.Body, &details) == nil {
+		apiErr.Message = details.Message
+		apiErr.Reason = details.Error
+		apiErr.Path = details.Path
+
+		// Spring either sends the timestamp as string or as milliseconds since epoch
+		var ts string
+		if json.Unmarshal(details.Timestamp, &ts) != nil {
+			ts = string(details.Timestamp)
+		}
+		apiErr.Timestamp = ts
+	}
+	return apiErr
+}
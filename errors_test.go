@@ -0,0 +1,92 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		status    int
+		body      string
+		message   string // expected Message, which is part of Error() as well
+		reason    string
+		path      string
+		timestamp string
+	}{
+		{
+			status:    http.StatusNotFound,
+			body:      `{"timestamp":"2018-06-12T09:33:12.345+0000","status":404,"error":"Not Found","message":"Project not found","path":"/api/v2/projects/1020"}`,
+			message:   "Project not found",
+			reason:    "Not Found",
+			path:      "/api/v2/projects/1020",
+			timestamp: "2018-06-12T09:33:12.345+0000",
+		},
+		{
+			status:    http.StatusUnauthorized,
+			body:      `{"timestamp":1528796000123,"status":401,"error":"Unauthorized","message":"Full authentication is required","path":"/api/v2/projects/1020"}`,
+			message:   "Full authentication is required",
+			reason:    "Unauthorized",
+			path:      "/api/v2/projects/1020",
+			timestamp: "1528796000123",
+		},
+		{
+			status: http.StatusForbidden,
+			body:   `{"error":"Forbidden"}`,
+			reason: "Forbidden",
+		},
+		{
+			status: http.StatusBadGateway,
+			body:   "<html>Bad Gateway</html>",
+		},
+	}
+	for _, tt := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			fmt.Fprint(w, tt.body)
+		}))
+		_, err := rex.GetProject(rex.NewClient(ts.Client(), rex.WithBaseURL(ts.URL)), "1020")
+		ts.Close()
+
+		var apiErr *rex.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("status %d: got error %v, want an APIError", tt.status, err)
+			continue
+		}
+		if apiErr.StatusCode != tt.status || apiErr.Method != "GET" || apiErr.URL != ts.URL+"/api/v2/projects/1020" || string(apiErr.Body) != tt.body {
+			t.Errorf("status %d: got request details %d %s %s %q", tt.status, apiErr.StatusCode, apiErr.Method, apiErr.URL, apiErr.Body)
+		}
+		if apiErr.Message != tt.message || apiErr.Reason != tt.reason || apiErr.Path != tt.path || apiErr.Timestamp != tt.timestamp {
+			t.Errorf("status %d: got message %q, error %q, path %q, timestamp %q", tt.status, apiErr.Message, apiErr.Reason, apiErr.Path, apiErr.Timestamp)
+		}
+
+		// The error message falls back to the reason and to the raw body
+		want := tt.message
+		if want == "" {
+			want = tt.reason
+		}
+		if want == "" {
+			want = tt.body
+		}
+		if msg := fmt.Sprintf("GET %s/api/v2/projects/1020: got server status %d with error: %s", ts.URL, tt.status, want); err.Error() != msg {
+			t.Errorf("got error message %q, want %q", err.Error(), msg)
+		}
+
+		if rex.IsNotFound(err) != (tt.status == http.StatusNotFound) || rex.IsUnauthorized(err) != (tt.status == http.StatusUnauthorized) || rex.IsForbidden(err) != (tt.status == http.StatusForbidden) {
+			t.Errorf("status %d: got IsNotFound %v, IsUnauthorized %v, IsForbidden %v", tt.status, rex.IsNotFound(err), rex.IsUnauthorized(err), rex.IsForbidden(err))
+		}
+	}
+
+	// Wrapped errors are detected as well, other errors are not
+	err := fmt.Errorf("loading project: %w", &rex.APIError{StatusCode: http.StatusForbidden})
+	if !rex.IsForbidden(err) || rex.IsUnauthorized(err) || rex.IsForbidden(errors.New("forbidden")) {
+		t.Error("wrapped APIError has not been detected")
+	}
+}
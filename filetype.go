@@ -0,0 +1,133 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupportedFileType is returned if a file cannot be uploaded, because its format is not supported by REX.
+var ErrUnsupportedFileType = errors.New("unsupported file type")
+
+// ErrFileTypeMismatch is returned if the content of a project file is replaced by content of another file type.
+var ErrFileTypeMismatch = errors.New("file type does not match the project file")
+
+// FileType describes a file format which is supported by REX.
+type FileType struct {
+	Type        string   // Type of the project file, e.g. rex
+	ContentType string   // MIME type which is used for uploading the content
+	Extensions  []string // Known file extensions including the dot, e.g. .rex
+
+	// match returns true if the first bytes of the file belong to the format, the content
+	// of file types without match function is not checked
+	match func(head []byte) bool
+}
+
+// SupportedFileTypes contains all file formats which can be uploaded as project file.
+// Additional formats can be appended, their files are detected by the extension only.
+var SupportedFileTypes = []*FileType{
+	{Type: "rex", ContentType: "application/x-rex", Extensions: []string{".rex"}, match: hasPrefix("REX1")},
+	{Type: "e57", ContentType: "model/e57", Extensions: []string{".e57"}, match: hasPrefix("ASTM-E57")},
+	{Type: "fbx", ContentType: "application/x-fbx", Extensions: []string{".fbx"}, match: isFBX},
+	{Type: "ifc", ContentType: "application/x-step", Extensions: []string{".ifc"}, match: hasPrefix("ISO-10303-21;")},
+	{Type: "obj", ContentType: "model/obj", Extensions: []string{".obj"}, match: isText},
+	{Type: "pdf", ContentType: "application/pdf", Extensions: []string{".pdf"}, match: hasPrefix("%PDF-")},
+	{Type: "image", ContentType: "image/png", Extensions: []string{".png"}, match: isContentType("image/png")},
+	{Type: "image", ContentType: "image/jpeg", Extensions: []string{".jpg", ".jpeg"}, match: isContentType("image/jpeg")},
+	{Type: "image", ContentType: "image/gif", Extensions: []string{".gif"}, match: isContentType("image/gif")},
+	{Type: "image", ContentType: "image/bmp", Extensions: []string{".bmp"}, match: isContentType("image/bmp")},
+	{Type: "image", ContentType: "image/webp", Extensions: []string{".webp"}, match: isContentType("image/webp")},
+}
+
+// detectHeadSize is the number of bytes which are used for detecting the file type
+const detectHeadSize = 512
+
+// DetectFileType returns the file type using the extension of the fileName and the first
+// bytes of the content (at least 512 bytes if available).
+//
+// The content must match the format of the extension. ErrUnsupportedFileType is returned if
+// the extension is unknown or the content does not match.
+func DetectFileType(fileName string, head []byte) (*FileType, error) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, t := range SupportedFileTypes {
+		for _, e := range t.Extensions {
+			if e != ext {
+				continue
+			}
+			if t.match != nil && !t.match(head) {
+				return nil, fmt.Errorf("%w: content of %s is not a valid %s file", ErrUnsupportedFileType, fileName, t.Type)
+			}
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFileType, fileName)
+}
+
+// detectFileType reads the first bytes of r for detecting the file type. The returned reader
+// provides the full content of r. If r is an io.Seeker, r itself is returned, hence it can
+// still be used for seeking.
+func detectFileType(fileName string, r io.Reader) (*FileType, io.Reader, error) {
+	head := make([]byte, detectHeadSize)
+
+	seeker, ok := r.(io.Seeker)
+	var start int64
+	var err error
+	if ok {
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		ok = err == nil
+	}
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+
+	if ok {
+		if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		r = io.MultiReader(bytes.NewReader(head), r)
+	}
+
+	t, err := DetectFileType(fileName, head)
+	return t, r, err
+}
+
+// checkProjectFileType returns ErrFileTypeMismatch if the project file has another type than t.
+// Project files without a type accept any content.
+func checkProjectFileType(f *ProjectFile, t *FileType) error {
+	if f.Type != "" && f.Type != t.Type {
+		return fmt.Errorf("%w: project file %s is of type %s, the new content is %s", ErrFileTypeMismatch, f.ID, f.Type, t.Type)
+	}
+	return nil
+}
+
+func hasPrefix(magic string) func(head []byte) bool {
+	return func(head []byte) bool {
+		return bytes.HasPrefix(head, []byte(magic))
+	}
+}
+
+func isContentType(contentType string) func(head []byte) bool {
+	return func(head []byte) bool {
+		return http.DetectContentType(head) == contentType
+	}
+}
+
+// isFBX matches binary as well as ASCII FBX files
+func isFBX(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("Kaydara FBX Binary")) || bytes.HasPrefix(head, []byte("; FBX"))
+}
+
+// isText returns true if the content does not contain any binary data
+func isText(head []byte) bool {
+	return bytes.IndexByte(head, 0) < 0 && strings.HasPrefix(http.DetectContentType(head), "text/")
+}
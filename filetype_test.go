@@ -0,0 +1,108 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+func TestDetectFileType(t *testing.T) {
+	tests := []struct {
+		fileName    string
+		head        string
+		contentType string // empty if the file is not supported
+	}{
+		{"model.rex", "REX1\x00\x01", "application/x-rex"},
+		{"MODEL.REX", "REX1", "application/x-rex"},
+		{"scan.e57", "ASTM-E57\x00", "model/e57"},
+		{"model.fbx", "Kaydara FBX Binary  \x00", "application/x-fbx"},
+		{"model.fbx", "; FBX 7.4.0 project file", "application/x-fbx"},
+		{"building.ifc", "ISO-10303-21;\nHEADER;", "application/x-step"},
+		{"model.obj", "# cube\nv 0 0 0\n", "model/obj"},
+		{"plan.pdf", "%PDF-1.7\n", "application/pdf"},
+		{"image.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"image.jpg", "\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"image.jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"image.gif", "GIF89a\x01\x00", "image/gif"},
+		{"image.bmp", "BM\x36\x00", "image/bmp"},
+		{"image.webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+
+		// The content does not match the extension
+		{"model.rex", "REX2", ""},
+		{"model.obj", "v 0 0 0\x00", ""},
+		{"image.png", "\xff\xd8\xff\xe0\x00\x10JFIF", ""},
+		{"plan.pdf", "", ""},
+
+		// Unknown extensions
+		{"model.rex.zip", "REX1", ""},
+		{"model", "REX1", ""},
+		{"notes.txt", "hello", ""},
+	}
+	for _, tt := range tests {
+		fileType, err := rex.DetectFileType(tt.fileName, []byte(tt.head))
+		if tt.contentType == "" {
+			if !errors.Is(err, rex.ErrUnsupportedFileType) {
+				t.Errorf("%s %q: got %v, %v, want ErrUnsupportedFileType", tt.fileName, tt.head, fileType, err)
+			}
+			continue
+		}
+		if err != nil || fileType.ContentType != tt.contentType {
+			t.Errorf("%s %q: got %v, %v, want %s", tt.fileName, tt.head, fileType, err, tt.contentType)
+		}
+	}
+}
+
+func TestUploadUnsupportedFileType(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "filetype")
+
+	err := rex.UploadProjectFile(c, p.ID, "model", "model.rex", nil, strings.NewReader("not a rex file"))
+	if !errors.Is(err, rex.ErrUnsupportedFileType) {
+		t.Fatalf("got error %v, want ErrUnsupportedFileType", err)
+	}
+
+	// The file is rejected before any resource is created
+	if p, err = rex.GetProject(c, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Embedded.ProjectFiles) != 0 || len(p.Embedded.RexReferences) != 1 {
+		t.Errorf("got %d files and %d references, want only the root reference", len(p.Embedded.ProjectFiles), len(p.Embedded.RexReferences))
+	}
+}
+
+func TestDetectAppendedFileType(t *testing.T) {
+	saved := rex.SupportedFileTypes
+	defer func() { rex.SupportedFileTypes = saved }()
+	rex.SupportedFileTypes = append(rex.SupportedFileTypes[:len(saved):len(saved)], &rex.FileType{Type: "las", ContentType: "application/vnd.las", Extensions: []string{".las"}})
+
+	fileType, err := rex.DetectFileType("scan.las", []byte("LASF"))
+	if err != nil || fileType.ContentType != "application/vnd.las" {
+		t.Errorf("got %v, %v, want application/vnd.las", fileType, err)
+	}
+}
+
+func TestReplaceProjectFileContentTypeMismatch(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "filetype")
+	f, err := rex.UploadProjectFileWithResult(c, p.ID, "model", "model.obj", nil, strings.NewReader("v 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rex.ReplaceProjectFileContent(c, f.ProjectFile.ID, "plan.pdf", strings.NewReader("%PDF-1.7\n"))
+	if !errors.Is(err, rex.ErrFileTypeMismatch) {
+		t.Fatalf("got error %v, want ErrFileTypeMismatch", err)
+	}
+
+	// The content can be replaced after changing the type
+	if _, err = rex.SetProjectFileType(c, f.ProjectFile.ID, "pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err = rex.ReplaceProjectFileContent(c, f.ProjectFile.ID, "plan.pdf", strings.NewReader("%PDF-1.7\n")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// GeoJSONPoint is the position type of a GeoJSON point
+const GeoJSONPoint = "Point"
+
+// WGS84 ellipsoid parameters
+const (
+	wgs84A  = 6378137.0               // semi-major axis in meters
+	wgs84F  = 1 / 298.257223563       // flattening
+	wgs84B  = wgs84A * (1 - wgs84F)   // semi-minor axis in meters
+	wgs84E2 = wgs84F * (2 - wgs84F)   // first eccentricity squared
+	wgs84Ep = wgs84E2 / (1 - wgs84E2) // second eccentricity squared
+	degrees = 180 / math.Pi           // radians to degrees
+	radians = math.Pi / 180           // degrees to radians
+)
+
+// GeoPosition is a WGS84 position. Latitude and longitude are given in degrees, the
+// altitude is the ellipsoidal height in meters.
+type GeoPosition struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+// Validate checks whether latitude and longitude are within the valid range.
+func (p GeoPosition) Validate() error {
+	for _, v := range []float64{p.Latitude, p.Longitude, p.Altitude} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("invalid position %v: coordinates must be finite", p)
+		}
+	}
+	if p.Latitude < -90 || p.Latitude > 90 {
+		return fmt.Errorf("invalid latitude %v: must be within [-90, 90]", p.Latitude)
+	}
+	if p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("invalid longitude %v: must be within [-180, 180]", p.Longitude)
+	}
+	return nil
+}
+
+// Coordinates returns the position as GeoJSON coordinates (longitude, latitude, altitude).
+func (p GeoPosition) Coordinates() []float64 {
+	return []float64{p.Longitude, p.Latitude, p.Altitude}
+}
+
+// GeoPositionFromCoordinates creates a position from GeoJSON coordinates, which are given
+// as longitude, latitude and an optional altitude.
+func GeoPositionFromCoordinates(coordinates []float64) (GeoPosition, error) {
+	if len(coordinates) != 2 && len(coordinates) != 3 {
+		return GeoPosition{}, fmt.Errorf("invalid number of coordinates %d: expected longitude, latitude and optional altitude", len(coordinates))
+	}
+	p := GeoPosition{Longitude: coordinates[0], Latitude: coordinates[1]}
+	if len(coordinates) == 3 {
+		p.Altitude = coordinates[2]
+	}
+	return p, p.Validate()
+}
+
+// NewGeoTransformation creates a transformation positioned at the given WGS84 position
+// (GeoJSON point) without rotation. It can be used as absoluteTransformation for CreateProject.
+func NewGeoTransformation(p GeoPosition) (*ProjectTransformation, error) {
+	t := &ProjectTransformation{}
+	if err := t.SetGeoPosition(p); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// SetGeoPosition sets the position to a GeoJSON point at the given WGS84 position.
+func (t *ProjectTransformation) SetGeoPosition(p GeoPosition) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	t.Position.Type = GeoJSONPoint
+	t.Position.Coordinates = p.Coordinates()
+	return nil
+}
+
+// GeoPosition returns the WGS84 position of the transformation. An error is returned if
+// the position is not a valid GeoJSON point.
+func (t *ProjectTransformation) GeoPosition() (GeoPosition, error) {
+	if t == nil {
+		return GeoPosition{}, fmt.Errorf("transformation is not set")
+	}
+	if t.Position.Type != GeoJSONPoint {
+		return GeoPosition{}, fmt.Errorf("invalid position type %q: expected %q", t.Position.Type, GeoJSONPoint)
+	}
+	return GeoPositionFromCoordinates(t.Position.Coordinates)
+}
+
+// ECEF converts the position into earth-centered, earth-fixed coordinates in meters.
+func (p GeoPosition) ECEF() Vector3 {
+	lat, lon := p.Latitude*radians, p.Longitude*radians
+	sinLat, cosLat := math.Sin(lat), math.Cos(lat)
+	n := wgs84A / math.Sqrt(1-wgs84E2*sinLat*sinLat)
+
+	return Vector3{
+		X: (n + p.Altitude) * cosLat * math.Cos(lon),
+		Y: (n + p.Altitude) * cosLat * math.Sin(lon),
+		Z: (n*(1-wgs84E2) + p.Altitude) * sinLat,
+	}
+}
+
+// GeoPositionFromECEF converts earth-centered, earth-fixed coordinates in meters into
+// a WGS84 position.
+func GeoPositionFromECEF(v Vector3) GeoPosition {
+	lon := math.Atan2(v.Y, v.X)
+	p := math.Hypot(v.X, v.Y)
+
+	// Bowring's formula as initial value, refined iteratively
+	theta := math.Atan2(v.Z*wgs84A, p*wgs84B)
+	sinT, cosT := math.Sin(theta), math.Cos(theta)
+	lat := math.Atan2(v.Z+wgs84Ep*wgs84B*sinT*sinT*sinT, p-wgs84E2*wgs84A*cosT*cosT*cosT)
+
+	var n float64
+	for i := 0; i < 5; i++ {
+		sinLat := math.Sin(lat)
+		n = wgs84A / math.Sqrt(1-wgs84E2*sinLat*sinLat)
+		lat = math.Atan2(v.Z+wgs84E2*n*sinLat, p)
+	}
+	sinLat, cosLat := math.Sin(lat), math.Cos(lat)
+	n = wgs84A / math.Sqrt(1-wgs84E2*sinLat*sinLat)
+
+	return GeoPosition{
+		Latitude:  lat * degrees,
+		Longitude: lon * degrees,
+		Altitude:  p*cosLat + v.Z*sinLat - wgs84A*wgs84A/n,
+	}
+}
+
+// ENUFrame is a local east-north-up frame in meters, which is tangent to the WGS84
+// ellipsoid at its origin.
+type ENUFrame struct {
+	Origin GeoPosition
+	ecef   Vector3 // origin in ECEF
+	rot    Matrix4 // rotation from ECEF to ENU
+}
+
+// NewENUFrame creates a local frame with the given origin.
+func NewENUFrame(origin GeoPosition) (*ENUFrame, error) {
+	if err := origin.Validate(); err != nil {
+		return nil, err
+	}
+	lat, lon := origin.Latitude*radians, origin.Longitude*radians
+	sinLat, cosLat := math.Sin(lat), math.Cos(lat)
+	sinLon, cosLon := math.Sin(lon), math.Cos(lon)
+
+	return &ENUFrame{
+		Origin: origin,
+		ecef:   origin.ECEF(),
+		rot: Matrix4{
+			-sinLon, cosLon, 0, 0,
+			-sinLat * cosLon, -sinLat * sinLon, cosLat, 0,
+			cosLat * cosLon, cosLat * sinLon, sinLat, 0,
+			0, 0, 0, 1,
+		},
+	}, nil
+}
+
+// FromECEF converts earth-centered, earth-fixed coordinates into the local frame.
+func (f *ENUFrame) FromECEF(v Vector3) Vector3 {
+	return f.rot.TransformDirection(Vector3{v.X - f.ecef.X, v.Y - f.ecef.Y, v.Z - f.ecef.Z})
+}
+
+// ToECEF converts local coordinates into earth-centered, earth-fixed coordinates.
+func (f *ENUFrame) ToECEF(v Vector3) Vector3 {
+	// the inverse of a rotation is its transpose
+	r := f.rot
+	return Vector3{
+		X: r[0]*v.X + r[4]*v.Y + r[8]*v.Z + f.ecef.X,
+		Y: r[1]*v.X + r[5]*v.Y + r[9]*v.Z + f.ecef.Y,
+		Z: r[2]*v.X + r[6]*v.Y + r[10]*v.Z + f.ecef.Z,
+	}
+}
+
+// FromGeoPosition converts a WGS84 position into the local frame.
+func (f *ENUFrame) FromGeoPosition(p GeoPosition) Vector3 {
+	return f.FromECEF(p.ECEF())
+}
+
+// ToGeoPosition converts local coordinates into a WGS84 position.
+func (f *ENUFrame) ToGeoPosition(v Vector3) GeoPosition {
+	return GeoPositionFromECEF(f.ToECEF(v))
+}
+
+// GetProjectENUFrame returns the local frame of the project specified by the projectID (e.g. 1020).
+// The frame is anchored at the position of the absoluteTransformation of the root reference,
+// which must be a valid GeoJSON point.
+func GetProjectENUFrame(e Executor, projectID string) (*ENUFrame, error) {
+	return GetProjectENUFrameContext(context.Background(), e, projectID)
+}
+
+// GetProjectENUFrameContext is like GetProjectENUFrame but uses the given context for the request.
+func GetProjectENUFrameContext(ctx context.Context, e Executor, projectID string) (*ENUFrame, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	root, err := GetReferenceByLinkContext(ctx, e, base+apiProjects+"/"+projectID+"/rootRexReference")
+	if err != nil {
+		return nil, err
+	}
+	origin, err := root.AbsTransform.GeoPosition()
+	if err != nil {
+		return nil, fmt.Errorf("root reference of project %s has no geo position: %w", projectID, err)
+	}
+	return NewENUFrame(origin)
+}
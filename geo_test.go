@@ -0,0 +1,175 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+func TestECEF(t *testing.T) {
+	// Semi-major axis a = 6378137 m and semi-minor axis b = 6356752.3142 m as published
+	// in NIMA TR8350.2 (Department of Defense World Geodetic System 1984), table 3.3
+	const a, b = 6378137.0, 6356752.3142
+
+	tests := []struct {
+		p    rex.GeoPosition
+		ecef rex.Vector3
+	}{
+		{rex.GeoPosition{Latitude: 0, Longitude: 0}, rex.Vector3{X: a}},
+		{rex.GeoPosition{Latitude: 0, Longitude: 90}, rex.Vector3{Y: a}},
+		{rex.GeoPosition{Latitude: 0, Longitude: -90, Altitude: 1000}, rex.Vector3{Y: -a - 1000}},
+		{rex.GeoPosition{Latitude: 0, Longitude: 180, Altitude: -100}, rex.Vector3{X: -a + 100}},
+		{rex.GeoPosition{Latitude: 90, Longitude: 0}, rex.Vector3{Z: b}},
+		{rex.GeoPosition{Latitude: -90, Longitude: 0, Altitude: 500}, rex.Vector3{Z: -b - 500}},
+	}
+	for _, tt := range tests {
+		if got := tt.p.ECEF(); !nearVector(got, tt.ecef, 1e-4) {
+			t.Errorf("%+v: got ECEF %v, want %v", tt.p, got, tt.ecef)
+		}
+
+		got := rex.GeoPositionFromECEF(tt.ecef)
+		if !near(got.Latitude, tt.p.Latitude, 1e-9) || !near(got.Altitude, tt.p.Altitude, 1e-4) {
+			t.Errorf("%v: got %+v, want %+v", tt.ecef, got, tt.p)
+		}
+		// The longitude of the poles is undefined
+		if math.Abs(tt.p.Latitude) != 90 && !near(got.Longitude, tt.p.Longitude, 1e-9) {
+			t.Errorf("%v: got longitude %v, want %v", tt.ecef, got.Longitude, tt.p.Longitude)
+		}
+	}
+}
+
+func TestECEFRoundTrip(t *testing.T) {
+	for _, lat := range []float64{-89.9, -60, -45, -0.5, 0, 12.3, 47.07, 80, 89.99} {
+		for _, lon := range []float64{-179.9, -90, -15.44, 0, 15.44, 135, 180} {
+			for _, alt := range []float64{-1000, 0, 350, 8848, 400000} {
+				p := rex.GeoPosition{Latitude: lat, Longitude: lon, Altitude: alt}
+				got := rex.GeoPositionFromECEF(p.ECEF())
+				if !near(got.Latitude, lat, 1e-9) || !near(got.Longitude, lon, 1e-9) || !near(got.Altitude, alt, 1e-6) {
+					t.Fatalf("%+v: got %+v", p, got)
+				}
+			}
+		}
+	}
+}
+
+func TestENUFrame(t *testing.T) {
+	origin := rex.GeoPosition{Latitude: 47.07, Longitude: 15.44, Altitude: 350}
+	f, err := rex.NewENUFrame(origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f.FromGeoPosition(origin); !nearVector(got, rex.Vector3{}, 1e-6) {
+		t.Errorf("origin: got %v, want (0, 0, 0)", got)
+	}
+	above := origin
+	above.Altitude += 100
+	if got := f.FromGeoPosition(above); !nearVector(got, rex.Vector3{Z: 100}, 1e-6) {
+		t.Errorf("100 m above the origin: got %v", got)
+	}
+	if got := f.FromGeoPosition(rex.GeoPosition{Latitude: origin.Latitude, Longitude: origin.Longitude + 0.001, Altitude: origin.Altitude}); got.X <= 0 || !near(got.Y, 0, 0.01) {
+		t.Errorf("east of the origin: got %v", got)
+	}
+	if got := f.FromGeoPosition(rex.GeoPosition{Latitude: origin.Latitude + 0.001, Longitude: origin.Longitude, Altitude: origin.Altitude}); got.Y <= 0 || !near(got.X, 0, 1e-6) {
+		t.Errorf("north of the origin: got %v", got)
+	}
+
+	for _, v := range []rex.Vector3{{X: 10, Y: 20, Z: 3}, {X: -1500, Y: 800, Z: -40}, {X: 25000, Y: -30000, Z: 1000}} {
+		p := f.ToGeoPosition(v)
+		if got := f.FromGeoPosition(p); !nearVector(got, v, 1e-6) {
+			t.Errorf("%v: round trip returns %v", v, got)
+		}
+		if got := f.FromECEF(f.ToECEF(v)); !nearVector(got, v, 1e-6) {
+			t.Errorf("%v: ECEF round trip returns %v", v, got)
+		}
+
+		// The frame is a rigid transformation, distances are kept
+		d := p.ECEF()
+		o := origin.ECEF()
+		if dist := math.Sqrt((d.X-o.X)*(d.X-o.X) + (d.Y-o.Y)*(d.Y-o.Y) + (d.Z-o.Z)*(d.Z-o.Z)); !near(dist, math.Sqrt(v.X*v.X+v.Y*v.Y+v.Z*v.Z), 1e-6) {
+			t.Errorf("%v: distance %v differs", v, dist)
+		}
+	}
+
+	if _, err = rex.NewENUFrame(rex.GeoPosition{Latitude: 91}); err == nil {
+		t.Error("frame with an invalid origin has been created")
+	}
+}
+
+func TestGeoPositionValidate(t *testing.T) {
+	tests := []struct {
+		p     rex.GeoPosition
+		valid bool
+	}{
+		{rex.GeoPosition{}, true},
+		{rex.GeoPosition{Latitude: 90, Longitude: 180, Altitude: -400}, true},
+		{rex.GeoPosition{Latitude: -90, Longitude: -180, Altitude: 9000}, true},
+		{rex.GeoPosition{Latitude: 90.0001}, false},
+		{rex.GeoPosition{Latitude: -90.0001}, false},
+		{rex.GeoPosition{Longitude: 180.0001}, false},
+		{rex.GeoPosition{Longitude: -180.0001}, false},
+		{rex.GeoPosition{Latitude: math.NaN()}, false},
+		{rex.GeoPosition{Longitude: math.Inf(1)}, false},
+		{rex.GeoPosition{Altitude: math.Inf(-1)}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.p.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%+v: got error %v, want valid %v", tt.p, err, tt.valid)
+		}
+	}
+}
+
+func TestGeoPositionFromCoordinates(t *testing.T) {
+	tests := []struct {
+		coordinates []float64
+		want        rex.GeoPosition
+		valid       bool
+	}{
+		{nil, rex.GeoPosition{}, false},
+		{[]float64{15.44}, rex.GeoPosition{}, false},
+		{[]float64{15.44, 47.07}, rex.GeoPosition{Latitude: 47.07, Longitude: 15.44}, true},
+		{[]float64{15.44, 47.07, 350}, rex.GeoPosition{Latitude: 47.07, Longitude: 15.44, Altitude: 350}, true},
+		{[]float64{15.44, 47.07, 350, 1}, rex.GeoPosition{}, false},
+		{[]float64{47.07, 95}, rex.GeoPosition{}, false}, // latitude out of range
+	}
+	for _, tt := range tests {
+		got, err := rex.GeoPositionFromCoordinates(tt.coordinates)
+		if (err == nil) != tt.valid {
+			t.Errorf("%v: got error %v, want valid %v", tt.coordinates, err, tt.valid)
+			continue
+		}
+		if tt.valid && got != tt.want {
+			t.Errorf("%v: got %+v, want %+v", tt.coordinates, got, tt.want)
+		}
+	}
+
+	p := rex.GeoPosition{Latitude: 47.07, Longitude: 15.44, Altitude: 350}
+	if got, err := rex.GeoPositionFromCoordinates(p.Coordinates()); err != nil || got != p {
+		t.Errorf("round trip: got %+v, %v", got, err)
+	}
+}
+
+func TestGetProjectENUFrame(t *testing.T) {
+	_, c := newTestClient(t)
+
+	origin := rex.GeoPosition{Latitude: 47.07, Longitude: 15.44, Altitude: 350}
+	abs, err := rex.NewGeoTransformation(origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := rex.CreateProject(c, c.User.UserID, "geo", nil, abs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := rex.GetProjectENUFrame(c, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Origin != origin {
+		t.Errorf("got origin %+v, want %+v", f.Origin, origin)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"testing"
+
+	"github.com/breiting/rex"
+	"github.com/breiting/rex/rextest"
+)
+
+// newTestClient starts a fake REX server, which is closed at the end of the test, and returns
+// a client which is logged in to it. The server can be configured before the login, e.g. for
+// changing the token lifetime.
+func newTestClient(t *testing.T, configure ...func(s *rextest.Server)) (*rextest.Server, *rex.Client) {
+	t.Helper()
+	s := rextest.NewServer()
+	t.Cleanup(s.Close)
+	for _, fn := range configure {
+		fn(s)
+	}
+	c, err := s.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+// newTestProject creates a project with a root reference on the fake server
+func newTestProject(t *testing.T, c *rex.Client, name string) *rex.Project {
+	t.Helper()
+	p, err := rex.CreateProject(c, c.User.UserID, name, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,247 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExecutorFunc is an adapter to allow the use of ordinary functions as Executor.
+type ExecutorFunc func(req *http.Request) (*http.Response, error)
+
+// Execute fullfills the Executor interface and calls f(req)
+func (f ExecutorFunc) Execute(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// BaseURL fullfills the BaseURLProvider interface. A function does not know the REX instance
+// it talks to, hence API calls using a bare ExecutorFunc fail with ErrNoBaseURL. Use
+// ExecutorWithBaseURL or Chain in order to set the base URL.
+func (f ExecutorFunc) BaseURL() string {
+	return ""
+}
+
+// ExecutorWithBaseURL returns an Executor which performs all requests using e and
+// uses the given REX base URL (e.g. https://rex.robotic-eyes.com) for all API calls.
+func ExecutorWithBaseURL(e Executor, baseURL string) Executor {
+	return &baseURLExecutor{Executor: e, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// baseURLExecutor is the Executor returned by ExecutorWithBaseURL
+type baseURLExecutor struct {
+	Executor
+	baseURL string
+}
+
+// BaseURL fullfills the BaseURLProvider interface
+func (e *baseURLExecutor) BaseURL() string {
+	return e.baseURL
+}
+
+// Middleware wraps an Executor in order to add behavior around the actual request.
+type Middleware func(next Executor) Executor
+
+// Chain wraps the Executor e with the given middlewares. The first middleware is the
+// outermost one, it sees the request first and the response last.
+//
+// The returned Executor uses the base URL of e, hence it can be used for all API calls
+//
+//	e := Chain(client, UserAgentMiddleware("rx/1.0"), LoggingMiddleware(slog.Default()))
+//	project, err := GetProject(e, "1020")
+func Chain(e Executor, mw ...Middleware) Executor {
+	next := e
+	for i := len(mw) - 1; i >= 0; i-- {
+		next = mw[i](next)
+	}
+	return &chain{Executor: next, base: e}
+}
+
+// chain is the Executor returned by Chain
+type chain struct {
+	Executor
+	base Executor // the executor which has been wrapped
+}
+
+// BaseURL fullfills the BaseURLProvider interface and returns the base URL of the wrapped executor
+func (c *chain) BaseURL() string {
+	u, _ := baseURL(c.base)
+	return u
+}
+
+// wrap returns fn as Executor, which uses the base URL of next
+func wrap(next Executor, fn ExecutorFunc) Executor {
+	return &chain{Executor: fn, base: next}
+}
+
+// redactedHeaders contains all headers which must not appear in logs
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// LoggingMiddleware logs every request and its response using the given logger.
+//
+// The request and response headers are logged on debug level, whereas the Authorization,
+// Cookie and Set-Cookie headers are redacted. Responses are logged on info level, failed
+// requests on error level.
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return func(next Executor) Executor {
+		return wrap(next, func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			logger.DebugContext(ctx, "rex request",
+				slog.String("method", req.Method),
+				slog.String("url", req.URL.String()),
+				slog.Any("header", redactHeader(req.Header)),
+			)
+
+			start := time.Now()
+			resp, err := next.Execute(req)
+			duration := time.Since(start)
+
+			if err != nil {
+				logger.ErrorContext(ctx, "rex request failed",
+					slog.String("method", req.Method),
+					slog.String("url", req.URL.String()),
+					slog.Duration("duration", duration),
+					slog.String("error", err.Error()),
+				)
+				return resp, err
+			}
+			logger.InfoContext(ctx, "rex response",
+				slog.String("method", req.Method),
+				slog.String("url", req.URL.String()),
+				slog.Int("status", resp.StatusCode),
+				slog.Duration("duration", duration),
+			)
+			logger.DebugContext(ctx, "rex response header",
+				slog.String("method", req.Method),
+				slog.String("url", req.URL.String()),
+				slog.Any("header", redactHeader(resp.Header)),
+			)
+			return resp, err
+		})
+	}
+}
+
+// redactHeader returns a copy of the header, where all sensitive values are replaced
+func redactHeader(h http.Header) http.Header {
+	redacted := h.Clone()
+	for _, key := range redactedHeaders {
+		if _, ok := redacted[key]; ok {
+			redacted.Set(key, "REDACTED")
+		}
+	}
+	return redacted
+}
+
+// UserAgentMiddleware sets the User-Agent header of every request.
+func UserAgentMiddleware(userAgent string) Middleware {
+	return func(next Executor) Executor {
+		return wrap(next, func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("User-Agent", userAgent)
+			return next.Execute(req)
+		})
+	}
+}
+
+// RequestIDMiddleware adds a unique request ID (UUID) to every request using the given
+// header (e.g. X-Request-ID). Requests which already carry the header are not changed.
+func RequestIDMiddleware(header string) Middleware {
+	return func(next Executor) Executor {
+		return wrap(next, func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == "" {
+				req.Header.Set(header, uuid.New().String())
+			}
+			return next.Execute(req)
+		})
+	}
+}
+
+// EndpointStats contains the latency counters of a single endpoint.
+type EndpointStats struct {
+	Endpoint string        // Method and normalized path, e.g. "GET /api/v2/projects/{id}"
+	Count    int64         // Number of requests
+	Errors   int64         // Number of requests which failed or got a status >= 400
+	Total    time.Duration // Sum of all request durations
+	Max      time.Duration // Longest request duration
+}
+
+// Average returns the average duration of a request
+func (s EndpointStats) Average() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// LatencyMetrics collects latency counters per endpoint. It is safe for concurrent use.
+type LatencyMetrics struct {
+	mu    sync.Mutex
+	stats map[string]*EndpointStats
+}
+
+// Stats returns a snapshot of the counters of all endpoints, sorted by endpoint.
+func (m *LatencyMetrics) Stats() []EndpointStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]EndpointStats, 0, len(m.stats))
+	for _, s := range m.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Endpoint < stats[j].Endpoint })
+	return stats
+}
+
+func (m *LatencyMetrics) record(endpoint string, duration time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stats == nil {
+		m.stats = make(map[string]*EndpointStats)
+	}
+	s, ok := m.stats[endpoint]
+	if !ok {
+		s = &EndpointStats{Endpoint: endpoint}
+		m.stats[endpoint] = s
+	}
+	s.Count++
+	s.Total += duration
+	if duration > s.Max {
+		s.Max = duration
+	}
+	if failed {
+		s.Errors++
+	}
+}
+
+// LatencyMiddleware records the duration of every request in m.
+//
+// Requests are grouped by method and path, whereas IDs and keys in the path are
+// replaced by {id}, hence /api/v2/projects/1020 is counted as /api/v2/projects/{id}.
+func LatencyMiddleware(m *LatencyMetrics) Middleware {
+	return func(next Executor) Executor {
+		return wrap(next, func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Execute(req)
+			failed := err != nil || resp.StatusCode >= 400
+			m.record(req.Method+" "+endpointPath(req.URL.Path), time.Since(start), failed)
+			return resp, err
+		})
+	}
+}
+
+var idSegment = regexp.MustCompile(`/([0-9]+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})(/|$)`)
+
+// endpointPath replaces all numeric IDs and UUIDs in the path by {id}
+func endpointPath(path string) string {
+	for idSegment.MatchString(path) {
+		path = idSegment.ReplaceAllString(path, "/{id}$2")
+	}
+	return path
+}
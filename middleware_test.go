@@ -0,0 +1,202 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/breiting/rex"
+	"github.com/google/uuid"
+)
+
+// respond returns an Executor which answers every request with the given status
+func respond(status int) rex.Executor {
+	return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	})
+}
+
+// logRecord is a single line written by the slog.JSONHandler
+type logRecord struct {
+	Level  string              `json:"level"`
+	Msg    string              `json:"msg"`
+	Status int                 `json:"status"`
+	Error  string              `json:"error"`
+	Header map[string][]string `json:"header"`
+}
+
+func parseLog(t *testing.T, b *bytes.Buffer) []logRecord {
+	t.Helper()
+	var records []logRecord
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		var r logRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret-session"})
+		w.Header().Set("X-Response", "visible")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	var b bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&b, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	e := rex.Chain(rex.ExecutorFunc(ts.Client().Do), rex.LoggingMiddleware(logger))
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Cookie", "session=secret-session")
+	req.Header.Set("X-Request", "visible")
+	resp, err := e.Execute(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if strings.Contains(b.String(), "secret") {
+		t.Errorf("log contains a secret: %s", b.String())
+	}
+	records := parseLog(t, &b)
+	if len(records) != 3 {
+		t.Fatalf("got %d log records, want 3", len(records))
+	}
+	request, response, header := records[0], records[1], records[2]
+
+	if request.Level != "DEBUG" || request.Header["X-Request"][0] != "visible" {
+		t.Errorf("got request record %+v", request)
+	}
+	for _, key := range []string{"Authorization", "Cookie"} {
+		if v := request.Header[key]; len(v) != 1 || v[0] != "REDACTED" {
+			t.Errorf("request header %s logged as %v", key, v)
+		}
+	}
+	if response.Level != "INFO" || response.Status != http.StatusCreated {
+		t.Errorf("got response record %+v", response)
+	}
+	if header.Level != "DEBUG" || header.Header["X-Response"][0] != "visible" {
+		t.Errorf("got response header record %+v", header)
+	}
+	if v := header.Header["Set-Cookie"]; len(v) != 1 || v[0] != "REDACTED" {
+		t.Errorf("response header Set-Cookie logged as %v", v)
+	}
+
+	// The header of the request itself is not changed
+	if req.Header.Get("Authorization") != "Bearer secret-token" {
+		t.Error("Authorization header of the request has been redacted")
+	}
+}
+
+func TestLoggingMiddlewareError(t *testing.T) {
+	var b bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&b, nil))
+	e := rex.Chain(rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}), rex.LoggingMiddleware(logger))
+
+	req, _ := http.NewRequest("GET", "http://rex.invalid/api/v2/projects", nil)
+	if _, err := e.Execute(req); err == nil {
+		t.Fatal("request succeeded")
+	}
+	records := parseLog(t, &b)
+	if len(records) != 1 || records[0].Level != "ERROR" || records[0].Error != "connection refused" {
+		t.Errorf("got log records %+v, want a single error", records)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var ids []string
+	e := rex.Chain(rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+		ids = append(ids, req.Header.Get("X-Request-ID"))
+		return respond(http.StatusOK).Execute(req)
+	}), rex.RequestIDMiddleware("X-Request-ID"))
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://rex.invalid/", nil)
+		if _, err := e.Execute(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, _ := http.NewRequest("GET", "http://rex.invalid/", nil)
+	req.Header.Set("X-Request-ID", "caller-id")
+	if _, err := e.Execute(req); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids[:2] {
+		if _, err := uuid.Parse(id); err != nil {
+			t.Errorf("generated request ID %q is not a UUID", id)
+		}
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("both requests got the request ID %s", ids[0])
+	}
+	if ids[2] != "caller-id" {
+		t.Errorf("got request ID %q, want the caller-supplied one", ids[2])
+	}
+}
+
+func TestLatencyMiddleware(t *testing.T) {
+	statuses := map[string]int{"/api/v2/projects/1020": http.StatusOK, "/api/v2/projects/1021": http.StatusNoContent, "/api/v2/projects/404": http.StatusNotFound}
+	var m rex.LatencyMetrics
+	e := rex.Chain(rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+		status, ok := statuses[req.URL.Path]
+		if !ok {
+			return nil, errors.New("connection reset")
+		}
+		return respond(status).Execute(req)
+	}), rex.LatencyMiddleware(&m))
+
+	requests := []struct {
+		method, path string
+	}{
+		{"GET", "/api/v2/projects/1020"},
+		{"GET", "/api/v2/projects/1021"},
+		{"GET", "/api/v2/projects/404"},
+		{"DELETE", "/api/v2/projects/1020"},
+		{"GET", "/api/v2/rexReferences/1033/childReferences"},
+		{"GET", "/api/v2/rexReferences/0f8fad5b-d9cb-469f-a165-70867728950e/projectFiles/1044"},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(r.method, "http://rex.invalid"+r.path, nil)
+		e.Execute(req)
+	}
+
+	want := []rex.EndpointStats{
+		{Endpoint: "DELETE /api/v2/projects/{id}", Count: 1},
+		{Endpoint: "GET /api/v2/projects/{id}", Count: 3, Errors: 1},
+		{Endpoint: "GET /api/v2/rexReferences/{id}/childReferences", Count: 1, Errors: 1},
+		{Endpoint: "GET /api/v2/rexReferences/{id}/projectFiles/{id}", Count: 1, Errors: 1},
+	}
+	stats := m.Stats()
+	if len(stats) != len(want) {
+		t.Fatalf("got %+v, want %+v", stats, want)
+	}
+	for i, s := range stats {
+		if s.Endpoint != want[i].Endpoint || s.Count != want[i].Count || s.Errors != want[i].Errors {
+			t.Errorf("got %+v, want %+v", s, want[i])
+		}
+		if s.Max > s.Total || s.Average() > s.Max {
+			t.Errorf("%s: inconsistent durations %+v", s.Endpoint, s)
+		}
+	}
+}
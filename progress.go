@@ -0,0 +1,93 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ProgressInterval is the minimum time between two progress reports of a transfer.
+var ProgressInterval = 200 * time.Millisecond
+
+// Progress describes the state of a running upload or download.
+type Progress struct {
+	BytesDone  int64   // Number of bytes which have been transferred, including resumed bytes
+	BytesTotal int64   // Total number of bytes, -1 if unknown
+	Rate       float64 // Average transfer rate in bytes per second
+}
+
+// ProgressFunc is called during a transfer. The last call of a successful transfer reports all bytes.
+// For uploads, the function is called from the goroutine which sends the request body.
+type ProgressFunc func(p Progress)
+
+type progressKey struct{}
+
+// WithProgress returns a copy of ctx, which lets all transfers using the context report their
+// progress to fn. This applies to the upload of project files (e.g. UploadProjectFileContext)
+// as well as to downloads (e.g. DownloadFileToDirContext).
+//
+// A transfer is aborted by cancelling the context.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ProgressChannel returns a ProgressFunc which sends the progress to ch. If ch is not ready
+// to receive, the report is dropped, hence a slow receiver does not block the transfer.
+func ProgressChannel(ch chan<- Progress) ProgressFunc {
+	return func(p Progress) {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// progressReader reports the number of bytes read
+type progressReader struct {
+	r        io.Reader
+	fn       ProgressFunc
+	start    time.Time
+	last     time.Time
+	initial  int64
+	done     int64
+	total    int64
+	finished bool
+}
+
+// newProgressReader wraps r, if the context has a ProgressFunc. The number of bytes
+// which have already been transferred before is given by done.
+func newProgressReader(ctx context.Context, r io.Reader, done, total int64) io.Reader {
+	fn, ok := ctx.Value(progressKey{}).(ProgressFunc)
+	if !ok || fn == nil {
+		return r
+	}
+	now := time.Now()
+	return &progressReader{r: r, fn: fn, start: now, last: now, initial: done, done: done, total: total}
+}
+
+// Read fullfills the io.Reader interface
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+
+	now := time.Now()
+	if err == io.EOF && !p.finished {
+		p.finished = true
+		p.report(now)
+	} else if n > 0 && now.Sub(p.last) >= ProgressInterval {
+		p.report(now)
+	}
+	return n, err
+}
+
+func (p *progressReader) report(now time.Time) {
+	p.last = now
+
+	var rate float64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.done-p.initial) / elapsed
+	}
+	p.fn(Progress{BytesDone: p.done, BytesTotal: p.total, Rate: rate})
+}
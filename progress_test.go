@@ -0,0 +1,106 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/breiting/rex"
+)
+
+// progressContent is large enough to be transferred with several reads
+var progressContent = strings.Repeat("v 0 0 0\n", 16*1024)
+
+// progressRecorder collects all progress reports, which may be sent from another goroutine
+type progressRecorder struct {
+	mu      sync.Mutex
+	reports []rex.Progress
+}
+
+func (r *progressRecorder) report(p rex.Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, p)
+}
+
+// check verifies that the progress increases monotonically and reports all bytes at the end
+func (r *progressRecorder) check(t *testing.T, total int64) {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.reports) < 2 {
+		t.Fatalf("got %d progress reports, want several", len(r.reports))
+	}
+	for i := 1; i < len(r.reports); i++ {
+		if r.reports[i].BytesDone < r.reports[i-1].BytesDone {
+			t.Errorf("progress decreased from %d to %d", r.reports[i-1].BytesDone, r.reports[i].BytesDone)
+		}
+	}
+	last := r.reports[len(r.reports)-1]
+	if last.BytesDone != total || last.BytesTotal != total {
+		t.Errorf("got final progress %+v, want %d bytes", last, total)
+	}
+}
+
+// reportAll lets every read of a transfer report its progress
+func reportAll(t *testing.T) {
+	interval := rex.ProgressInterval
+	rex.ProgressInterval = 0
+	t.Cleanup(func() { rex.ProgressInterval = interval })
+}
+
+func TestUploadProgress(t *testing.T) {
+	reportAll(t)
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "progress")
+
+	var r progressRecorder
+	ctx := rex.WithProgress(context.Background(), r.report)
+	if err := rex.UploadProjectFileContext(ctx, c, p.ID, "model", "model.obj", nil, strings.NewReader(progressContent)); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, int64(len(progressContent)))
+}
+
+func TestDownloadProgress(t *testing.T) {
+	reportAll(t)
+	_, c := newTestClient(t)
+	_, link := newDownloadProject(t, c, progressContent)
+
+	var r progressRecorder
+	var b bytes.Buffer
+	ctx := rex.WithProgress(context.Background(), r.report)
+	if _, err := rex.DownloadFileToContext(ctx, c, link, &b); err != nil {
+		t.Fatal(err)
+	}
+	r.check(t, int64(len(progressContent)))
+}
+
+func TestProgressChannel(t *testing.T) {
+	reportAll(t)
+	_, c := newTestClient(t)
+	_, link := newDownloadProject(t, c, progressContent)
+
+	// Nobody receives from the channel, the download must not block anyway
+	ch := make(chan rex.Progress, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var b bytes.Buffer
+	if _, err := rex.DownloadFileToContext(rex.WithProgress(ctx, rex.ProgressChannel(ch)), c, link, &b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first report fits into the channel, all others have been dropped
+	if len(ch) != 1 {
+		t.Fatalf("got %d reports in the channel, want 1", len(ch))
+	}
+	if p := <-ch; p.BytesDone == int64(len(progressContent)) {
+		t.Errorf("got final progress %+v, want the first report", p)
+	}
+}
@@ -1,13 +1,12 @@
 package rex
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
-	"regexp"
 )
 
 var (
@@ -16,6 +15,7 @@ var (
 
 // Project is the full structure of a REX project.
 type Project struct {
+	ID          string // auto-generated after getting the project
 	DateCreated string `json:"dateCreated"`
 	CreatedBy   string `json:"createdBy"`
 	LastUpdated string `json:"lastUpdated"`
@@ -179,7 +179,16 @@ func min(a, b int) int {
 
 // GetProject retrieves the full project specified by the projectID (e.g. 1020)
 func GetProject(e Executor, projectID string) (*Project, error) {
-	req, _ := http.NewRequest("GET", RexBaseURL+apiProject+projectID, nil)
+	return GetProjectContext(context.Background(), e, projectID)
+}
+
+// GetProjectContext is like GetProject but uses the given context for the request.
+func GetProjectContext(ctx context.Context, e Executor, projectID string) (*Project, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", base+apiProject+projectID, nil)
 
 	resp, err := e.Execute(req)
 	if err != nil {
@@ -188,49 +197,159 @@ func GetProject(e Executor, projectID string) (*Project, error) {
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 	}()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
 
 	var project Project
 	err = json.NewDecoder(resp.Body).Decode(&project)
+	project.ID = projectID
 	return &project, err
 
 }
 
-// DownloadFile downloads a given link (e.g. project file link).
+// ProjectUpdate contains the project properties which should be changed.
+// Only the fields which are not nil are sent to the server.
+type ProjectUpdate struct {
+	Name        *string `json:"name,omitempty"`
+	TagLine     *string `json:"tagLine,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Type        *string `json:"type,omitempty"`
+}
+
+// UpdateProject changes the properties of the project specified by the projectID (e.g. 1020)
+// and returns the updated project.
+func UpdateProject(e Executor, projectID string, update *ProjectUpdate) (*Project, error) {
+	return UpdateProjectContext(context.Background(), e, projectID, update)
+}
+
+// UpdateProjectContext is like UpdateProject but uses the given context for all requests.
+func UpdateProjectContext(ctx context.Context, e Executor, projectID string, update *ProjectUpdate) (*Project, error) {
+
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	var project Project
+	if err := patchJSON(ctx, e, base+apiProject+projectID, update, &project); err != nil {
+		return nil, err
+	}
+	project.ID = projectID
+	return &project, nil
+}
+
+// RenameProject changes the name of the project specified by the projectID (e.g. 1020)
+// and returns the updated project.
+func RenameProject(e Executor, projectID string, name string) (*Project, error) {
+	return RenameProjectContext(context.Background(), e, projectID, name)
+}
+
+// RenameProjectContext is like RenameProject but uses the given context for all requests.
+func RenameProjectContext(ctx context.Context, e Executor, projectID string, name string) (*Project, error) {
+	return UpdateProjectContext(ctx, e, projectID, &ProjectUpdate{Name: &name})
+}
+
+// DeletedProject contains the self links of all resources which have been removed by DeleteProject.
+type DeletedProject struct {
+	ProjectID     string
+	ProjectFiles  []string // Self links of the deleted project files
+	RexReferences []string // Self links of the deleted rexReferences
+}
+
+// DeleteProject removes the project specified by the projectID (e.g. 1020).
 //
-// The file name is anticipated by the provided information from the server
-// using the content-disposition
-func DownloadFile(e Executor, link string) error {
-	req, _ := http.NewRequest("GET", link, nil)
+// If cascade is set, all project files and rexReferences of the project are deleted
+// before the project itself. The rexReferences are deleted children first, the root
+// reference last. If an error occurs, the returned DeletedProject contains all
+// resources which have been removed so far.
+func DeleteProject(e Executor, projectID string, cascade bool) (*DeletedProject, error) {
+	return DeleteProjectContext(context.Background(), e, projectID, cascade)
+}
 
-	// Set content disposition in order to get information about the filename
-	req.Header.Add("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+// DeleteProjectContext is like DeleteProject but uses the given context for all requests.
+func DeleteProjectContext(ctx context.Context, e Executor, projectID string, cascade bool) (*DeletedProject, error) {
 
-	response, err := e.Execute(req)
+	deleted := &DeletedProject{ProjectID: projectID}
+	base, err := baseURL(e)
 	if err != nil {
-		return err
+		return deleted, err
 	}
-	defer response.Body.Close()
 
-	contentInfo := response.Header.Get("Content-Disposition")
+	if cascade {
+		project, err := GetProjectContext(ctx, e, projectID)
+		if err != nil {
+			return deleted, err
+		}
+
+		// The references are removed bottom up, since a reference cannot be removed as long as
+		// it has children. The tree reflects the current hierarchy, which differs from the order
+		// of creation if files have been moved (see MoveProjectFile).
+		tree, err := GetReferenceTreeContext(ctx, e, projectID)
+		if err != nil && !IsNotFound(err) {
+			return deleted, err
+		}
+		var refs []string
+		for _, ref := range project.Embedded.RexReferences {
+			// References which are not attached to the root reference are removed first
+			if !ref.RootReference && (tree == nil || tree.FindByLink(ref.Links.Self.Href) == nil) {
+				refs = append([]string{ref.Links.Self.Href}, refs...)
+			}
+		}
+		if tree != nil {
+			tree.walkPostOrder(func(node *ReferenceTree) error {
+				refs = append(refs, node.Reference.Links.Self.Href)
+				return nil
+			})
+		}
 
-	fileName := "default.dat"
-	re, _ := regexp.Compile("filename=\"(.*)\"")
-	values := re.FindStringSubmatch(contentInfo)
-	if len(values) > 0 {
-		fileName = values[1]
+		for _, f := range project.Embedded.ProjectFiles {
+			if err = deleteLink(ctx, e, f.Links.Self.Href); err != nil {
+				return deleted, err
+			}
+			deleted.ProjectFiles = append(deleted.ProjectFiles, f.Links.Self.Href)
+		}
+		for _, ref := range refs {
+			if err = deleteLink(ctx, e, ref); err != nil {
+				return deleted, err
+			}
+			deleted.RexReferences = append(deleted.RexReferences, ref)
+		}
 	}
 
-	output, err := os.Create(fileName)
+	return deleted, deleteLink(ctx, e, base+apiProject+projectID)
+}
+
+// deleteLink removes the resource identified by the given link
+func deleteLink(ctx context.Context, e Executor, link string) error {
+	req, _ := http.NewRequestWithContext(ctx, "DELETE", link, nil)
+
+	resp, err := e.Execute(req)
 	if err != nil {
 		return err
 	}
-	defer output.Close()
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	return checkResponse(resp, http.StatusOK, http.StatusNoContent)
+}
+
+// DownloadFile downloads a given link (e.g. project file link).
+//
+// The file name is anticipated by the provided information from the server
+// using the content-disposition. The file is stored in the working directory and a
+// summary is printed to stdout, use DownloadFileTo or DownloadFileToDir otherwise.
+func DownloadFile(e Executor, link string) error {
+	return DownloadFileContext(context.Background(), e, link)
+}
 
-	n, err := io.Copy(output, response.Body)
+// DownloadFileContext is like DownloadFile but uses the given context for the request.
+// Cancelling the context aborts a running download.
+func DownloadFileContext(ctx context.Context, e Executor, link string) error {
+	result, err := DownloadFileToDirContext(ctx, e, link, ".")
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(n, "bytes downloaded and stored in", fileName, ".")
+	fmt.Println(result.Size, "bytes downloaded and stored in", result.FileName, ".")
 	return nil
 }
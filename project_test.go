@@ -0,0 +1,142 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+func TestDeleteProjectCascadeMovedReference(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "delete")
+	first, err := rex.UploadProjectFileWithResult(c, p.ID, "first", "first.obj", nil, strings.NewReader("v 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := rex.UploadProjectFileWithResult(c, p.ID, "second", "second.obj", nil, strings.NewReader("v 1 1 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reference which has been created last becomes the parent of the first one,
+	// hence deleting the references in reverse order of creation fails
+	parent, err := rex.GetProjectFileReference(c, second.ProjectFile.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rex.MoveProjectFile(c, p.ID, first.ProjectFile.ID, parent.Links.Self.Href, nil); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := rex.GetReferenceTree(c, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := rex.DeleteProject(c, p.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted.ProjectFiles) != 2 {
+		t.Errorf("got %d deleted project files, want 2", len(deleted.ProjectFiles))
+	}
+	want := []string{"first", "second", "root"}
+	if len(deleted.RexReferences) != len(want) {
+		t.Fatalf("got %d deleted references, want %d", len(deleted.RexReferences), len(want))
+	}
+	nodes := map[string]string{
+		"first":  tree.Children[0].Children[0].Reference.Links.Self.Href,
+		"second": tree.Children[0].Reference.Links.Self.Href,
+		"root":   tree.Reference.Links.Self.Href,
+	}
+	for i, name := range want {
+		if deleted.RexReferences[i] != nodes[name] {
+			t.Errorf("reference %d: got %s, want the %s reference %s", i, deleted.RexReferences[i], name, nodes[name])
+		}
+	}
+
+	if _, err = rex.GetProject(c, p.ID); !rex.IsNotFound(err) {
+		t.Errorf("project still exists: %v", err)
+	}
+}
+
+func TestRenameProject(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "original")
+
+	renamed, err := rex.RenameProject(c, p.ID, "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.ID != p.ID || renamed.Name != "renamed" || renamed.Owner != p.Owner || renamed.UpdatedBy != c.User.UserID {
+		t.Errorf("got project %+v after the rename", renamed)
+	}
+	if p, err = rex.GetProject(c, p.ID); err != nil || p.Name != "renamed" {
+		t.Errorf("got project %+v and error %v, want the new name", p, err)
+	}
+	if _, err = rex.RenameProject(c, p.ID, ""); err == nil {
+		t.Error("project has been renamed to an empty name")
+	}
+}
+
+// noContent returns a middleware which answers all PATCH requests with status 204 and an empty
+// body, like servers which only return the updated resource on request. All GET requests are counted.
+func noContent(gets *int) rex.Middleware {
+	return func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "GET" {
+				*gets++
+			}
+			resp, err := next.Execute(req)
+			if err != nil || req.Method != "PATCH" || resp.StatusCode != http.StatusOK {
+				return resp, err
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			resp.StatusCode = http.StatusNoContent
+			resp.Status = "204 No Content"
+			resp.ContentLength = 0
+			resp.Body = ioutil.NopCloser(strings.NewReader(""))
+			return resp, nil
+		})
+	}
+}
+
+func TestUpdateProject(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "update")
+
+	var gets int
+	e := rex.Chain(c, noContent(&gets))
+	tagLine, description := "tag line", "description"
+	updated, err := rex.UpdateProject(e, p.ID, &rex.ProjectUpdate{TagLine: &tagLine, Description: &description})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The updated project has been fetched after the empty response
+	if gets != 1 {
+		t.Errorf("got %d GET requests, want 1", gets)
+	}
+	if updated.ID != p.ID || updated.Name != "update" || updated.TagLine != tagLine || updated.Description != description {
+		t.Errorf("got project %+v after the update", updated)
+	}
+
+	// Fields which are not set are kept
+	name := "renamed"
+	if updated, err = rex.UpdateProject(e, p.ID, &rex.ProjectUpdate{Name: &name}); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != name || updated.TagLine != tagLine || updated.Description != description {
+		t.Errorf("got project %+v after the second update", updated)
+	}
+
+	if _, err = rex.UpdateProject(e, p.ID+"0", &rex.ProjectUpdate{Name: &name}); !rex.IsNotFound(err) {
+		t.Errorf("unknown project: got error %v, want status 404", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// ProjectFile is a single file of a project. The content of the file can be
+// downloaded using the file.download link.
+type ProjectFile struct {
+	ID           string            `json:"-"` // auto-generated after getting the file
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	FileSize     int               `json:"fileSize"`
+	LastModified string            `json:"lastModified"`
+	Links        *ProjectFileLinks `json:"_links,omitempty"`
+}
+
+// ProjectFileLinks contains the links of a project file
+type ProjectFileLinks struct {
+	Self struct {
+		Href string `json:"href"`
+	} `json:"self"`
+	Project struct {
+		Href string `json:"href"`
+	} `json:"project"`
+	RexReference struct {
+		Href string `json:"href"`
+	} `json:"rexReference"`
+	FileUpload struct {
+		Href string `json:"href"`
+	} `json:"file.upload"`
+	FileUploadResumable struct {
+		Href string `json:"href"`
+	} `json:"file.upload.resumable"` // experimental, only sent by servers which support resumable uploads
+	FileDownload struct {
+		Href string `json:"href"`
+	} `json:"file.download"`
+}
+
+// ProjectFileUpdate contains the project file properties which should be changed.
+// Only the fields which are not nil are sent to the server.
+type ProjectFileUpdate struct {
+	Name *string `json:"name,omitempty"`
+	Type *string `json:"type,omitempty"`
+}
+
+// GetProjectFile retrieves the project file specified by the fileID (e.g. 1044).
+func GetProjectFile(e Executor, fileID string) (*ProjectFile, error) {
+	return GetProjectFileContext(context.Background(), e, fileID)
+}
+
+// GetProjectFileContext is like GetProjectFile but uses the given context for the request.
+func GetProjectFileContext(ctx context.Context, e Executor, fileID string) (*ProjectFile, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	var f ProjectFile
+	if err := getJSON(ctx, e, base+apiProjectFiles+fileID, &f); err != nil {
+		return nil, err
+	}
+	f.ID = fileID
+	return &f, nil
+}
+
+// UpdateProjectFile changes the properties of the project file specified by the fileID (e.g. 1044)
+// and returns the updated project file. The content of the file is not changed.
+func UpdateProjectFile(e Executor, fileID string, update *ProjectFileUpdate) (*ProjectFile, error) {
+	return UpdateProjectFileContext(context.Background(), e, fileID, update)
+}
+
+// UpdateProjectFileContext is like UpdateProjectFile but uses the given context for all requests.
+func UpdateProjectFileContext(ctx context.Context, e Executor, fileID string, update *ProjectFileUpdate) (*ProjectFile, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	var f ProjectFile
+	if err := patchJSON(ctx, e, base+apiProjectFiles+fileID, update, &f); err != nil {
+		return nil, err
+	}
+	f.ID = fileID
+	return &f, nil
+}
+
+// RenameProjectFile changes the displayed name of the project file specified by the fileID (e.g. 1044).
+func RenameProjectFile(e Executor, fileID string, name string) (*ProjectFile, error) {
+	return RenameProjectFileContext(context.Background(), e, fileID, name)
+}
+
+// RenameProjectFileContext is like RenameProjectFile but uses the given context for all requests.
+func RenameProjectFileContext(ctx context.Context, e Executor, fileID string, name string) (*ProjectFile, error) {
+	return UpdateProjectFileContext(ctx, e, fileID, &ProjectFileUpdate{Name: &name})
+}
+
+// SetProjectFileType changes the type of the project file specified by the fileID (e.g. 1044),
+// e.g. to rex.
+func SetProjectFileType(e Executor, fileID string, fileType string) (*ProjectFile, error) {
+	return SetProjectFileTypeContext(context.Background(), e, fileID, fileType)
+}
+
+// SetProjectFileTypeContext is like SetProjectFileType but uses the given context for all requests.
+func SetProjectFileTypeContext(ctx context.Context, e Executor, fileID string, fileType string) (*ProjectFile, error) {
+	return UpdateProjectFileContext(ctx, e, fileID, &ProjectFileUpdate{Type: &fileType})
+}
+
+// ReplaceProjectFileContent uploads new content for the existing project file specified by the
+// fileID (e.g. 1044). The name, type and reference of the project file are kept. Like for
+// UploadProjectFile, the content must be of a supported file type (see DetectFileType).
+// ErrFileTypeMismatch is returned if it is not of the type of the project file, use
+// SetProjectFileType for changing the type first.
+func ReplaceProjectFileContent(e Executor, fileID string, fileName string, r io.Reader) error {
+	return ReplaceProjectFileContentContext(context.Background(), e, fileID, fileName, r)
+}
+
+// ReplaceProjectFileContentContext is like ReplaceProjectFileContent but uses the given context
+// for all requests. Cancelling the context aborts a running upload.
+func ReplaceProjectFileContentContext(ctx context.Context, e Executor, fileID string, fileName string, r io.Reader) error {
+	_, err := ReplaceProjectFileContentWithResultContext(ctx, e, fileID, fileName, r)
+	return err
+}
+
+// ReplaceProjectFileContentWithResult is like ReplaceProjectFileContent, but returns the project
+// file as well as the checksums of the uploaded content.
+func ReplaceProjectFileContentWithResult(e Executor, fileID string, fileName string, r io.Reader) (*UploadResult, error) {
+	return ReplaceProjectFileContentWithResultContext(context.Background(), e, fileID, fileName, r)
+}
+
+// ReplaceProjectFileContentWithResultContext is like ReplaceProjectFileContentWithResult but uses
+// the given context for all requests. Cancelling the context aborts a running upload.
+func ReplaceProjectFileContentWithResultContext(ctx context.Context, e Executor, fileID string, fileName string, r io.Reader) (*UploadResult, error) {
+	fileType, r, err := detectFileType(fileName, r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := GetProjectFileContext(ctx, e, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if f.Links == nil || f.Links.FileUpload.Href == "" {
+		return nil, fmt.Errorf("project file %s has no upload link", fileID)
+	}
+	if err = checkProjectFileType(f, fileType); err != nil {
+		return nil, err
+	}
+	result, err := uploadFileContent(ctx, e, f.Links.FileUpload.Href, fileName, fileType.ContentType, r)
+	if result != nil {
+		result.ProjectFile = f
+	}
+	return result, err
+}
+
+// DeleteProjectFile removes the project file specified by the fileID (e.g. 1044).
+//
+// If deleteReference is set, the rexReference of the file is removed as well, unless it is
+// the root reference of the project. The reference cannot be removed if other files or
+// references are still attached to it.
+func DeleteProjectFile(e Executor, fileID string, deleteReference bool) error {
+	return DeleteProjectFileContext(context.Background(), e, fileID, deleteReference)
+}
+
+// DeleteProjectFileContext is like DeleteProjectFile but uses the given context for all requests.
+func DeleteProjectFileContext(ctx context.Context, e Executor, fileID string, deleteReference bool) error {
+	base, err := baseURL(e)
+	if err != nil {
+		return err
+	}
+
+	var ref *Reference
+	if deleteReference {
+		if ref, err = GetProjectFileReferenceContext(ctx, e, fileID); err != nil {
+			return err
+		}
+	}
+
+	if err := deleteLink(ctx, e, base+apiProjectFiles+fileID); err != nil {
+		return err
+	}
+	if ref == nil || ref.RootReference || ref.Links == nil {
+		return nil
+	}
+	if err := deleteLink(ctx, e, ref.Links.Self.Href); err != nil {
+		return fmt.Errorf("project file %s has been removed, but not its reference: %w", fileID, err)
+	}
+	return nil
+}
+
+// setID sets the ID using the self link of the project file
+func (f *ProjectFile) setID() {
+	if f.Links != nil {
+		f.ID = projectFileIDFromLink(f.Links.Self.Href)
+	}
+}
+
+// projectFileIDFromLink extracts the project file ID from a project file self link
+func projectFileIDFromLink(link string) string {
+	re, _ := regexp.Compile("/projectFiles/([^/?{]*)")
+	values := re.FindStringSubmatch(link)
+	if len(values) > 0 {
+		return values[1]
+	}
+	return ""
+}
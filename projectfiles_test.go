@@ -0,0 +1,123 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+// patchBodies returns an executor which records the bodies of all PATCH requests
+func patchBodies(c *rex.Client) (rex.Executor, *[]string) {
+	var bodies []string
+	e := rex.Chain(c, func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "PATCH" {
+				body, _ := ioutil.ReadAll(req.Body)
+				bodies = append(bodies, string(bytes.TrimSpace(body)))
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+			return next.Execute(req)
+		})
+	})
+	return e, &bodies
+}
+
+func TestRenameProjectFile(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "files")
+	fileID, _ := newFileReference(t, c, p.ID, "model")
+
+	e, bodies := patchBodies(c)
+	f, err := rex.RenameProjectFile(e, fileID, "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ID != fileID || f.Name != "renamed" || f.Type != "obj" {
+		t.Errorf("got project file %+v", f)
+	}
+	if len(*bodies) != 1 || (*bodies)[0] != `{"name":"renamed"}` {
+		t.Errorf("got PATCH bodies %q, want only the name", *bodies)
+	}
+	if f, err = rex.GetProjectFile(c, fileID); err != nil || f.Name != "renamed" {
+		t.Errorf("got project file %+v and error %v after the rename", f, err)
+	}
+
+	if _, err = rex.RenameProjectFile(c, fileID, ""); err == nil {
+		t.Error("project file has been renamed to an empty name")
+	}
+	if _, err = rex.RenameProjectFile(c, fileID+"0", "renamed"); !rex.IsNotFound(err) {
+		t.Errorf("unknown file: got error %v, want status 404", err)
+	}
+}
+
+func TestSetProjectFileType(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "files")
+	fileID, _ := newFileReference(t, c, p.ID, "model")
+
+	e, bodies := patchBodies(c)
+	f, err := rex.SetProjectFileType(e, fileID, "rex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ID != fileID || f.Type != "rex" || f.Name != "model" {
+		t.Errorf("got project file %+v", f)
+	}
+	if len(*bodies) != 1 || (*bodies)[0] != `{"type":"rex"}` {
+		t.Errorf("got PATCH bodies %q, want only the type", *bodies)
+	}
+}
+
+func TestDeleteProjectFile(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "files")
+	keptID, kept := newFileReference(t, c, p.ID, "kept")
+	removedID, removed := newFileReference(t, c, p.ID, "removed")
+
+	// Without deleteReference, the reference stays
+	if err := rex.DeleteProjectFile(c, keptID, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rex.GetProjectFile(c, keptID); !rex.IsNotFound(err) {
+		t.Errorf("got error %v for the removed file, want status 404", err)
+	}
+	if _, err := rex.GetReferenceByLink(c, kept.Links.Self.Href); err != nil {
+		t.Errorf("reference has been removed: %v", err)
+	}
+
+	if err := rex.DeleteProjectFile(c, removedID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rex.GetProjectFile(c, removedID); !rex.IsNotFound(err) {
+		t.Errorf("got error %v for the removed file, want status 404", err)
+	}
+	if _, err := rex.GetReferenceByLink(c, removed.Links.Self.Href); !rex.IsNotFound(err) {
+		t.Errorf("got error %v for the removed reference, want status 404", err)
+	}
+
+	if err := rex.DeleteProjectFile(c, removedID, true); !rex.IsNotFound(err) {
+		t.Errorf("second delete: got error %v, want status 404", err)
+	}
+
+	// A reference with children is kept, the file is removed anyway
+	parentID, parent := newFileReference(t, c, p.ID, "parent")
+	if _, err := rex.UpdateReference(c, kept.Links.Self.Href, &rex.ReferenceUpdate{ParentReference: parent.Links.Self.Href}); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *rex.APIError
+	if err := rex.DeleteProjectFile(c, parentID, true); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("got error %v, want status 409 of the reference", err)
+	}
+	if _, err := rex.GetProjectFile(c, parentID); !rex.IsNotFound(err) {
+		t.Errorf("got error %v for the removed file, want status 404", err)
+	}
+	if _, err := rex.GetReferenceByLink(c, parent.Links.Self.Href); err != nil {
+		t.Errorf("reference with children has been removed: %v", err)
+	}
+}
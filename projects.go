@@ -4,21 +4,30 @@ package rex
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
+	"net/textproto"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/tidwall/gjson"
 )
 
 // Reference is a spatial anchor which can be attached to a project or a project file.
+//
+// When creating a reference, Project and ParentReference contain the self links of the
+// project and the parent reference. References which are returned by the REX API
+// provide these links in Links instead.
 type Reference struct {
+	ID              string                 `json:"-"` // auto-generated after getting the reference
 	Key             string                 `json:"key"`
 	Project         string                 `json:"project"`
 	ParentReference string                 `json:"parentReference"`
@@ -27,6 +36,26 @@ type Reference struct {
 	AbsTransform    *ProjectTransformation `json:"absoluteTransformation"`
 	RelTransform    *ProjectTransformation `json:"relativeTransformation"`
 	FileTransform   *FileTransformation    `json:"fileTransformation"`
+	Links           *ReferenceLinks        `json:"_links,omitempty"`
+}
+
+// ReferenceLinks contains the links of a reference returned by the REX API.
+type ReferenceLinks struct {
+	Self struct {
+		Href string `json:"href"`
+	} `json:"self"`
+	Project struct {
+		Href string `json:"href"`
+	} `json:"project"`
+	ParentReference struct {
+		Href string `json:"href"`
+	} `json:"parentReference"`
+	ChildReferences struct {
+		Href string `json:"href"`
+	} `json:"childReferences"`
+	ProjectFiles struct {
+		Href string `json:"href"`
+	} `json:"projectFiles"`
 }
 
 // ProjectSimple is the basic structure representing a simple RexProject
@@ -43,11 +72,54 @@ type ProjectSimple struct {
 
 // ProjectSimpleList is a list ProjectSimple objects.
 //
-// Mainly required for JSON encoding/decoding
+// Mainly required for JSON encoding/decoding. Page and Links describe the
+// page of the list which has been fetched last.
 type ProjectSimpleList struct {
 	Embedded struct {
 		Projects []ProjectSimple `json:"projects"`
 	} `json:"_embedded"`
+	Page  Page `json:"page"`
+	Links struct {
+		Next struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"_links"`
+}
+
+// Page contains the paging information of a list returned by the REX API.
+type Page struct {
+	Size          int `json:"size"`          // Number of elements per page
+	TotalElements int `json:"totalElements"` // Number of elements of all pages
+	TotalPages    int `json:"totalPages"`    // Number of pages
+	Number        int `json:"number"`        // Number of the current page, starting with 0
+}
+
+// PageOptions specifies which page of a list should be fetched.
+type PageOptions struct {
+	Page int    // Page number, starting with 0
+	Size int    // Number of elements per page, the server default (20) is used if 0
+	Sort string // Sort criteria in the format property[,asc|desc], e.g. "name,desc"
+}
+
+// query returns the options as additional query parameters
+func (o *PageOptions) query() string {
+	if o == nil {
+		return ""
+	}
+	q := url.Values{}
+	if o.Page > 0 {
+		q.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Size > 0 {
+		q.Set("size", strconv.Itoa(o.Size))
+	}
+	if o.Sort != "" {
+		q.Set("sort", o.Sort)
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "&" + q.Encode()
 }
 
 // ProjectAddress defines the address information for a project
@@ -111,8 +183,90 @@ func (p ProjectSimpleList) String() string {
 //
 // This call only fetches the project list, but not the content of every project.
 // Please use GetProject for getting the detailed project information.
+// All pages of the list are fetched, use GetProjectsPage for fetching a single page.
 func GetProjects(e Executor, userID string) (*ProjectSimpleList, error) {
-	req, _ := http.NewRequest("GET", RexBaseURL+apiProjectByOwner+userID, nil)
+	return GetProjectsContext(context.Background(), e, userID)
+}
+
+// GetProjectsContext is like GetProjects but uses the given context for all requests.
+func GetProjectsContext(ctx context.Context, e Executor, userID string) (*ProjectSimpleList, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	var projects ProjectSimpleList
+	err = walkProjectPages(ctx, e, base+apiProjectByOwner+url.QueryEscape(userID), func(page *ProjectSimpleList) error {
+		projects.Embedded.Projects = append(projects.Embedded.Projects, page.Embedded.Projects...)
+		projects.Page = page.Page
+		projects.Links = page.Links
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &projects, nil
+}
+
+// GetProjectsPage gets a single page of the projects of the given user.
+//
+// If opts is nil, the first page with the default page size is returned. The Page field
+// of the result contains the paging information.
+func GetProjectsPage(e Executor, userID string, opts *PageOptions) (*ProjectSimpleList, error) {
+	return GetProjectsPageContext(context.Background(), e, userID, opts)
+}
+
+// GetProjectsPageContext is like GetProjectsPage but uses the given context for the request.
+func GetProjectsPageContext(ctx context.Context, e Executor, userID string, opts *PageOptions) (*ProjectSimpleList, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	return getProjectList(ctx, e, base+apiProjectByOwner+url.QueryEscape(userID)+opts.query())
+}
+
+// ForEachProject calls fn for every project of the given user. Starting with the page
+// specified by opts, all following pages are fetched until the last one is reached.
+//
+// If fn returns an error, the iteration is stopped and the error is returned.
+func ForEachProject(e Executor, userID string, opts *PageOptions, fn func(p ProjectSimple) error) error {
+	return ForEachProjectContext(context.Background(), e, userID, opts, fn)
+}
+
+// ForEachProjectContext is like ForEachProject but uses the given context for all requests.
+func ForEachProjectContext(ctx context.Context, e Executor, userID string, opts *PageOptions, fn func(p ProjectSimple) error) error {
+	base, err := baseURL(e)
+	if err != nil {
+		return err
+	}
+	return walkProjectPages(ctx, e, base+apiProjectByOwner+url.QueryEscape(userID)+opts.query(), func(page *ProjectSimpleList) error {
+		for _, p := range page.Embedded.Projects {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// walkProjectPages fetches the project list from the link and calls fn for every page,
+// as long as the server reports a next page.
+func walkProjectPages(ctx context.Context, e Executor, link string, fn func(page *ProjectSimpleList) error) error {
+	for link != "" {
+		page, err := getProjectList(ctx, e, link)
+		if err != nil {
+			return err
+		}
+		if err = fn(page); err != nil {
+			return err
+		}
+		link = page.Links.Next.Href
+	}
+	return nil
+}
+
+// getProjectList fetches a single page of a project list
+func getProjectList(ctx context.Context, e Executor, link string) (*ProjectSimpleList, error) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", link, nil)
 
 	resp, err := e.Execute(req)
 	if err != nil {
@@ -121,67 +275,124 @@ func GetProjects(e Executor, userID string) (*ProjectSimpleList, error) {
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 	}()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
 
 	var projects ProjectSimpleList
 	err = json.NewDecoder(resp.Body).Decode(&projects)
 
 	// set ID for convenience
 	for i, p := range projects.Embedded.Projects {
-		re, _ := regexp.Compile("/projects/(.*)")
-		values := re.FindStringSubmatch(p.Links.Self.Href)
-		if len(values) > 0 {
-			projects.Embedded.Projects[i].ID = values[1]
-		}
+		projects.Embedded.Projects[i].ID = projectIDFromLink(p.Links.Self.Href)
 	}
 	return &projects, err
 }
 
+// projectIDFromLink extracts the project ID from a project self link
+func projectIDFromLink(link string) string {
+	re, _ := regexp.Compile("/projects/(.*)")
+	values := re.FindStringSubmatch(link)
+	if len(values) > 0 {
+		return values[1]
+	}
+	return ""
+}
+
 // Creates a new RexReference using the REX API
-func createRexReference(e Executor, r *Reference) (string, error) {
+func createRexReference(ctx context.Context, e Executor, r *Reference) (string, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return "", err
+	}
 
 	b := new(bytes.Buffer)
 	json.NewEncoder(b).Encode(r)
 
-	req, _ := http.NewRequest("POST", RexBaseURL+apiRexReferences, b)
+	req, _ := http.NewRequestWithContext(ctx, "POST", base+apiRexReferences, b)
 	resp, err := e.Execute(req)
+	if err != nil {
+		return "", err
+	}
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 	}()
-	if err != nil {
+	if err = checkResponse(resp, http.StatusCreated); err != nil {
 		return "", err
 	}
 	body, _ := ioutil.ReadAll(resp.Body)
-	if resp.StatusCode != 201 {
-		return "", fmt.Errorf("Got server status %d with error: %s ", resp.StatusCode, body)
-	}
 	return gjson.Get(string(body), "_links.self.href").String(), nil
 }
 
 // CreateProject creates a new project for the current user.
 //
-// The name is used as project name
-func CreateProject(e Executor, userID, name string, address *ProjectAddress, absoluteTransformation *ProjectTransformation) error {
+// The name is used as project name. Together with the project, the root rexReference
+// is created. The returned project contains the ID, the self link and the root reference.
+//
+// If the root reference cannot be created, the project is removed again and the error
+// is returned. If removing the project fails as well, a RollbackError containing both
+// errors is returned together with the orphaned project.
+func CreateProject(e Executor, userID, name string, address *ProjectAddress, absoluteTransformation *ProjectTransformation) (*Project, error) {
+	return CreateProjectContext(context.Background(), e, userID, name, address, absoluteTransformation)
+}
+
+// CreateProjectContext is like CreateProject but uses the given context for all requests.
+func CreateProjectContext(ctx context.Context, e Executor, userID, name string, address *ProjectAddress, absoluteTransformation *ProjectTransformation) (*Project, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
 	p := ProjectSimple{Name: name, Owner: userID}
 
 	b := new(bytes.Buffer)
 	json.NewEncoder(b).Encode(p)
 
-	req, _ := http.NewRequest("POST", RexBaseURL+apiProjects, b)
+	req, _ := http.NewRequestWithContext(ctx, "POST", base+apiProjects, b)
 	resp, err := e.Execute(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	body, _ := ioutil.ReadAll(resp.Body)
-
-	if resp.StatusCode != 201 {
-		return fmt.Errorf("Got server status %d with error: %s ", resp.StatusCode, body)
+	if err = checkResponse(resp, http.StatusCreated); err != nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, err
 	}
+	var project Project
+	err = json.NewDecoder(resp.Body).Decode(&project)
 	io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return nil, err
+	}
 
-	projectSelfLink := gjson.Get(string(body), "_links.self.href").String()
-	uuid := uuid.New().String()
+	projectSelfLink := project.Links.Self.Href
+	project.ID = projectIDFromLink(projectSelfLink)
 
 	// Create a RexReference as well
+	key, referenceSelfLink, err := createRootReference(ctx, e, projectSelfLink, address, absoluteTransformation)
+	if err != nil {
+		// Remove the project again, even if the failure has been caused by cancelling ctx
+		rollbackErr := deleteLink(context.WithoutCancel(ctx), e, projectSelfLink)
+		if rollbackErr != nil {
+			return &project, &RollbackError{Err: err, RollbackErr: rollbackErr}
+		}
+		return nil, fmt.Errorf("cannot create root reference, project has been removed: %w", err)
+	}
+	project.Embedded.RootRexReference.RootReference = true
+	project.Embedded.RootRexReference.Key = key
+	project.Embedded.RootRexReference.Links.Self.Href = referenceSelfLink
+
+	// Fetch the project again in order to get all links and embedded resources.
+	// In case of an error, the project which has been created so far is returned.
+	created, err := GetProjectContext(ctx, e, project.ID)
+	if err != nil {
+		return &project, err
+	}
+	return created, nil
+}
+
+// createRootReference creates the root reference for the project with a new UUID as key.
+// The key and the self link of the reference are returned.
+func createRootReference(ctx context.Context, e Executor, projectSelfLink string, address *ProjectAddress, absoluteTransformation *ProjectTransformation) (string, string, error) {
+	uuid := uuid.New().String()
 	rexReference := Reference{
 		Project:       projectSelfLink,
 		RootReference: true,
@@ -190,16 +401,145 @@ func CreateProject(e Executor, userID, name string, address *ProjectAddress, abs
 		AbsTransform:  absoluteTransformation,
 	}
 
-	_, err = createRexReference(e, &rexReference)
-	return err
+	selfLink, err := createRexReference(ctx, e, &rexReference)
+	return uuid, selfLink, err
+}
+
+// getRootReferenceLink returns the self link of the root reference of the project.
+// If the project has no root reference, an APIError with status 404 is returned.
+func getRootReferenceLink(ctx context.Context, e Executor, projectID string) (string, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return "", err
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", base+apiProjects+"/"+projectID+"/rootRexReference", nil)
+	resp, err := e.Execute(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return gjson.Get(string(body), "_links.self.href").String(), nil
+}
+
+// EnsureRootReference creates the root reference of the project specified by the projectID
+// (e.g. 1020), if the project does not have one. This repairs projects which have been
+// created without a root reference, since UploadProjectFile requires it.
+//
+// The self link of the root reference is returned, created is set if the root
+// reference has been created by this call.
+func EnsureRootReference(e Executor, projectID string, address *ProjectAddress, absoluteTransformation *ProjectTransformation) (selfLink string, created bool, err error) {
+	return EnsureRootReferenceContext(context.Background(), e, projectID, address, absoluteTransformation)
+}
+
+// EnsureRootReferenceContext is like EnsureRootReference but uses the given context for all requests.
+func EnsureRootReferenceContext(ctx context.Context, e Executor, projectID string, address *ProjectAddress, absoluteTransformation *ProjectTransformation) (selfLink string, created bool, err error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return "", false, err
+	}
+	selfLink, err = getRootReferenceLink(ctx, e, projectID)
+	if err == nil {
+		return selfLink, false, nil
+	}
+	if !IsNotFound(err) {
+		return "", false, err
+	}
+
+	_, selfLink, err = createRootReference(ctx, e, base+apiProject+projectID, address, absoluteTransformation)
+	if err != nil {
+		return "", false, err
+	}
+	return selfLink, true, nil
+}
+
+// FindProjectsWithoutRootReference returns all projects of the given user which do not have
+// a root reference. Use EnsureRootReference for repairing them.
+func FindProjectsWithoutRootReference(e Executor, userID string) ([]ProjectSimple, error) {
+	return FindProjectsWithoutRootReferenceContext(context.Background(), e, userID)
+}
+
+// FindProjectsWithoutRootReferenceContext is like FindProjectsWithoutRootReference but uses
+// the given context for all requests.
+func FindProjectsWithoutRootReferenceContext(ctx context.Context, e Executor, userID string) ([]ProjectSimple, error) {
+	var projects []ProjectSimple
+	err := ForEachProjectContext(ctx, e, userID, nil, func(p ProjectSimple) error {
+		_, err := getRootReferenceLink(ctx, e, p.ID)
+		if IsNotFound(err) {
+			projects = append(projects, p)
+			return nil
+		}
+		return err
+	})
+	return projects, err
 }
 
 // UploadProjectFile uploads a new project file.
 //
 // The project is identified by the projectID (e.g. 1020). The file requires a name,
-// which is displayed, but also a fileName which includes the suffix. The fileName is used
-// for detecting the mimetype. The content of the file will be read from the io.Reader r.
+// which is displayed, but also a fileName which includes the suffix. The fileName and the
+// first bytes of the content are used for detecting the mimetype (see DetectFileType).
+// Files which are not supported by REX are rejected before any resource is created.
+//
+// The content of the file will be read from the io.Reader r and streamed to the server. If r is an io.Seeker (e.g. *os.File), the upload of the
+// content can be retried (see RetryExecutor).
+//
+// If the server reports a checksum (ETag), it is compared with the uploaded content. Use
+// UploadProjectFileWithResult to get the created project file and the checksums.
 func UploadProjectFile(e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.Reader) error {
+	return UploadProjectFileContext(context.Background(), e, projectID, name, fileName, transform, r)
+}
+
+// UploadProjectFileContext is like UploadProjectFile but uses the given context for all requests.
+// Cancelling the context aborts a running upload.
+func UploadProjectFileContext(ctx context.Context, e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.Reader) error {
+	_, err := UploadProjectFileWithResultContext(ctx, e, projectID, name, fileName, transform, r)
+	return err
+}
+
+// UploadProjectFileWithResult is like UploadProjectFile, but returns the created project file
+// as well as the checksums of the uploaded content.
+func UploadProjectFileWithResult(e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.Reader) (*UploadResult, error) {
+	return UploadProjectFileWithResultContext(context.Background(), e, projectID, name, fileName, transform, r)
+}
+
+// UploadProjectFileWithResultContext is like UploadProjectFileWithResult but uses the given context
+// for all requests. Cancelling the context aborts a running upload.
+func UploadProjectFileWithResultContext(ctx context.Context, e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.Reader) (*UploadResult, error) {
+	// Reject unsupported files before any resource is created
+	fileType, r, err := detectFileType(fileName, r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := createProjectFile(ctx, e, projectID, name, fileType.Type, transform)
+	if err != nil {
+		return nil, err
+	}
+
+	// Upload the actual payload
+	result, err := uploadFileContent(ctx, e, f.Links.FileUpload.Href, fileName, fileType.ContentType, r)
+	if result != nil {
+		result.ProjectFile = f
+	}
+	return result, err
+}
+
+// createProjectFile creates the rexReference and the project file, without uploading the content
+func createProjectFile(ctx context.Context, e Executor, projectID string, name string, fileType string, transform *FileTransformation) (*ProjectFile, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
 
 	b := new(bytes.Buffer)
 
@@ -207,36 +547,25 @@ func UploadProjectFile(e Executor, projectID string, name string, fileName strin
 	// Since RexReference and ProjectFile is a 1..n relationship, we have
 	// to create the RexReference before we create the ProjectFile
 
-	// Query the project reference (required)
-	rootReferenceURL := RexBaseURL + apiProjects + "/" + projectID + "/rootRexReference"
-	req, _ := http.NewRequest("GET", rootReferenceURL, b)
-	resp, err := e.Execute(req)
+	// Query the project reference (required), spit error if not available!
+	parentReferenceURL, err := getRootReferenceLink(ctx, e, projectID)
 	if err != nil {
-		return err
-	}
-	// Check if root reference is available, spit error if not!
-	if resp.StatusCode != 200 {
-		io.Copy(ioutil.Discard, resp.Body)
-		return fmt.Errorf("Cannot create project file reference, because no project reference is set")
+		return nil, fmt.Errorf("Cannot create project file reference, because no project reference is set: %w", err)
 	}
-	body, _ := ioutil.ReadAll(resp.Body)
-	io.Copy(ioutil.Discard, resp.Body)
-
-	parentReferenceURL := gjson.Get(string(body), "_links.self.href").String()
 
 	// Create a RexReference as well
 	uuid := uuid.New().String()
 	rexReference := Reference{
-		Project:         RexBaseURL + apiProjects + "/" + projectID,
+		Project:         base + apiProjects + "/" + projectID,
 		RootReference:   false,
 		ParentReference: parentReferenceURL,
 		Key:             uuid,
 		FileTransform:   transform,
 	}
 
-	selfLink, err := createRexReference(e, &rexReference)
+	selfLink, err := createRexReference(ctx, e, &rexReference)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	projectFile := struct {
@@ -246,59 +575,123 @@ func UploadProjectFile(e Executor, projectID string, name string, fileName strin
 		Type         string `json:"type,omitempty"`
 	}{
 		Name:         name,
-		Project:      RexBaseURL + apiProjects + "/" + projectID,
+		Project:      base + apiProjects + "/" + projectID,
 		RexReference: selfLink,
-	}
-
-	if filepath.Ext(fileName) == ".rex" {
-		projectFile.Type = "rex"
+		Type:         fileType,
 	}
 
 	// Create project file
 	json.NewEncoder(b).Encode(projectFile)
-	req, _ = http.NewRequest("POST", RexBaseURL+apiProjectFiles, b)
-	resp, err = e.Execute(req)
+	req, _ := http.NewRequestWithContext(ctx, "POST", base+apiProjectFiles, b)
+	resp, err := e.Execute(req)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	if err = checkResponse(resp, http.StatusCreated); err != nil {
+		return nil, err
+	}
+
+	var f ProjectFile
+	if err = json.NewDecoder(resp.Body).Decode(&f); err != nil {
+		return nil, err
+	}
+	f.setID()
+	return &f, nil
+}
+
+// uploadFileContent uploads the content as multipart form to the uploadURL. The content
+// is streamed, hence the memory usage does not depend on the file size. The checksums are
+// computed while uploading and compared with the ETag of the response.
+func uploadFileContent(ctx context.Context, e Executor, uploadURL string, fileName string, contentType string, r io.Reader) (*UploadResult, error) {
+
+	// Uploading the content again replaces the file, hence the request can be retried safely
+	h := newContentHash()
+	req, _ := http.NewRequestWithContext(withIdempotent(ctx), "POST", uploadURL, nil)
+	if err := setMultipartBody(req, fileName, contentType, r, h); err != nil {
+		return nil, err
 	}
-	body, _ = ioutil.ReadAll(resp.Body)
 
-	if resp.StatusCode != 201 {
+	resp, err := e.Execute(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
-		return fmt.Errorf("Got server status %d with error: %s ", resp.StatusCode, body)
+	}()
+	if err = checkResponse(resp); err != nil {
+		return nil, err
 	}
 
-	// Upload the actual payload
-	uploadURL := gjson.Get(string(body), "_links.file\\.upload.href").String()
-	io.Copy(ioutil.Discard, resp.Body)
-	return uploadFileContent(e, uploadURL, fileName, r)
+	result := &UploadResult{Size: h.Size(), Checksums: h.Checksums()}
+	return result, verifyChecksums(resp.Header, result.Checksums, uploadURL, false)
 }
 
-func uploadFileContent(e Executor, uploadURL string, fileName string, r io.Reader) error {
+// setMultipartBody sets the body of the request to a multipart form containing the
+// content of r as single file part with the given content type. The content is written
+// to h while it is sent.
+//
+// If r is an io.Seeker, the content length is computed up front and the body can be
+// replayed (e.g. by the RetryExecutor). Otherwise the body is sent chunked and cannot be replayed.
+func setMultipartBody(req *http.Request, fileName string, contentType string, r io.Reader, h *contentHash) error {
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, _ := writer.CreateFormFile("file", fileName)
-	io.Copy(part, r)
+	// Only the part header and the closing boundary are kept in memory, the content is streamed in between
+	b := new(bytes.Buffer)
+	writer := multipart.NewWriter(b)
+	partHeader := make(textproto.MIMEHeader)
+	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(fileName)))
+	partHeader.Set("Content-Type", contentType)
+	if _, err := writer.CreatePart(partHeader); err != nil {
+		return err
+	}
+	header := append([]byte(nil), b.Bytes()...)
+	b.Reset()
 	writer.Close()
+	trailer := b.Bytes()
 
-	req, _ := http.NewRequest("POST", uploadURL, body)
-	req.Header.Add("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	resp, err := e.Execute(req)
-	io.Copy(ioutil.Discard, resp.Body)
+	// Pipes and terminals implement io.Seeker as well, but seeking fails
+	seeker, ok := r.(io.Seeker)
+	var start, size int64
+	var err error
+	if ok {
+		start, size, err = seekerSize(seeker)
+	}
+	if !ok || err != nil {
+		content := io.TeeReader(newProgressReader(req.Context(), r, 0, -1), h)
+		req.ContentLength = -1
+		req.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(header), content, bytes.NewReader(trailer)))
+		return nil
+	}
+
+	req.ContentLength = int64(len(header)) + size + int64(len(trailer))
+	req.GetBody = func() (io.ReadCloser, error) {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		h.Reset()
+		content := io.TeeReader(newProgressReader(req.Context(), io.LimitReader(r, size), 0, size), h)
+		return ioutil.NopCloser(io.MultiReader(bytes.NewReader(header), content, bytes.NewReader(trailer))), nil
+	}
+	req.Body, err = req.GetBody()
 	return err
 }
 
-// UpdateProjectFile - test code
-func updateProjectFile(c *Client) {
-	var body = []byte(`{"type": "rex"}`)
-	req, _ := http.NewRequest("PATCH", RexBaseURL+"/api/v2/projectFiles/1044", bytes.NewBuffer(body))
-	c.Token.SetAuthHeader(req)
-	req.Header.Add("Content-Type", "application/json")
-	resp, err := c.httpClient.Do(req)
+// quoteEscaper escapes the file name of the content-disposition like mime/multipart does
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// seekerSize returns the current position and the number of remaining bytes of the seeker
+func seekerSize(seeker io.Seeker) (int64, int64, error) {
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
 	if err != nil {
-		panic(err)
+		return 0, 0, err
 	}
-	fmt.Println(resp.Status)
+	return start, end - start, nil
 }
@@ -0,0 +1,234 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/breiting/rex"
+	"github.com/breiting/rex/rextest"
+)
+
+// newProjects creates n projects named project-0 ... project-(n-1)
+func newProjects(t *testing.T, c *rex.Client, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		newTestProject(t, c, fmt.Sprintf("project-%d", i))
+	}
+}
+
+func TestGetProjects(t *testing.T) {
+	_, c := newTestClient(t)
+	newProjects(t, c, 25) // two pages using the default page size
+
+	projects, err := rex.GetProjects(c, c.User.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects.Embedded.Projects) != 25 {
+		t.Fatalf("got %d projects, want 25", len(projects.Embedded.Projects))
+	}
+	ids := make(map[string]bool)
+	for i, p := range projects.Embedded.Projects {
+		if p.Name != fmt.Sprintf("project-%d", i) || p.ID == "" || ids[p.ID] {
+			t.Errorf("project %d: got %q with ID %q", i, p.Name, p.ID)
+		}
+		ids[p.ID] = true
+	}
+	if projects.Page.TotalElements != 25 || projects.Page.Number != 1 {
+		t.Errorf("got page %+v, want the last page", projects.Page)
+	}
+}
+
+func TestGetProjectsPage(t *testing.T) {
+	_, c := newTestClient(t)
+	newProjects(t, c, 5)
+
+	tests := []struct {
+		opts  *rex.PageOptions
+		names []string
+		page  rex.Page
+	}{
+		{nil, []string{"project-0", "project-1", "project-2", "project-3", "project-4"}, rex.Page{Size: 20, TotalElements: 5, TotalPages: 1}},
+		{&rex.PageOptions{Size: 2}, []string{"project-0", "project-1"}, rex.Page{Size: 2, TotalElements: 5, TotalPages: 3}},
+		{&rex.PageOptions{Page: 2, Size: 2}, []string{"project-4"}, rex.Page{Size: 2, TotalElements: 5, TotalPages: 3, Number: 2}},
+		{&rex.PageOptions{Page: 3, Size: 2}, nil, rex.Page{Size: 2, TotalElements: 5, TotalPages: 3, Number: 3}},
+	}
+	for _, tt := range tests {
+		projects, err := rex.GetProjectsPage(c, c.User.UserID, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, p := range projects.Embedded.Projects {
+			names = append(names, p.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.names) || projects.Page != tt.page {
+			t.Errorf("%+v: got %v on page %+v, want %v on page %+v", tt.opts, names, projects.Page, tt.names, tt.page)
+		}
+	}
+}
+
+func TestForEachProject(t *testing.T) {
+	_, c := newTestClient(t)
+	newProjects(t, c, 5)
+
+	var names []string
+	err := rex.ForEachProject(c, c.User.UserID, &rex.PageOptions{Page: 1, Size: 2}, func(p rex.ProjectSimple) error {
+		names = append(names, p.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[project-2 project-3 project-4]"; fmt.Sprint(names) != want {
+		t.Errorf("got %v, want %s", names, want)
+	}
+
+	// The iteration stops with the first error
+	stop := errors.New("stop")
+	var n int
+	err = rex.ForEachProject(c, c.User.UserID, &rex.PageOptions{Size: 2}, func(p rex.ProjectSimple) error {
+		if n++; n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 3 {
+		t.Errorf("got error %v after %d projects, want %v after 3", err, n, stop)
+	}
+}
+
+func TestCreateProjectRollback(t *testing.T) {
+	s, c := newTestClient(t)
+
+	s.FailRequests("POST", "/api/v2/rexReferences", http.StatusInternalServerError, 1)
+	p, err := rex.CreateProject(c, c.User.UserID, "rollback", nil, nil)
+	var rollbackErr *rex.RollbackError
+	if err == nil || p != nil || errors.As(err, &rollbackErr) {
+		t.Fatalf("got project %v and error %v, want the project to be removed", p, err)
+	}
+	var apiErr *rex.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("got error %v, want the error of the reference", err)
+	}
+
+	projects, err := rex.GetProjects(c, c.User.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects.Embedded.Projects) != 0 {
+		t.Errorf("got %d projects after the rollback, want none", len(projects.Embedded.Projects))
+	}
+}
+
+func TestCreateProjectRollbackFailed(t *testing.T) {
+	s, c := newTestClient(t)
+
+	deleteErr := errors.New("connection reset")
+	e := rex.Chain(c, func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "DELETE" {
+				return nil, deleteErr
+			}
+			return next.Execute(req)
+		})
+	})
+	s.FailRequests("POST", "/api/v2/rexReferences", http.StatusInternalServerError, 1)
+	p, err := rex.CreateProject(e, c.User.UserID, "rollback", nil, nil)
+	var rollbackErr *rex.RollbackError
+	if !errors.As(err, &rollbackErr) || !errors.Is(err, deleteErr) {
+		t.Fatalf("got error %v, want a RollbackError", err)
+	}
+	if p == nil || p.ID == "" {
+		t.Fatal("the orphaned project has not been returned")
+	}
+	if _, err := rex.GetProject(c, p.ID); err != nil {
+		t.Errorf("orphaned project %s: %v", p.ID, err)
+	}
+}
+
+// newProjectWithoutRootReference creates a project whose root reference could not be created,
+// and whose rollback failed as well
+func newProjectWithoutRootReference(t *testing.T, s *rextest.Server, c *rex.Client, name string) *rex.Project {
+	t.Helper()
+	e := rex.Chain(c, func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "DELETE" {
+				return nil, errors.New("connection reset")
+			}
+			return next.Execute(req)
+		})
+	})
+	s.FailRequests("POST", "/api/v2/rexReferences", http.StatusInternalServerError, 1)
+	p, err := rex.CreateProject(e, c.User.UserID, name, nil, nil)
+	var rollbackErr *rex.RollbackError
+	if !errors.As(err, &rollbackErr) {
+		t.Fatalf("got error %v, want a RollbackError", err)
+	}
+	return p
+}
+
+func TestEnsureRootReference(t *testing.T) {
+	s, c := newTestClient(t)
+	complete := newTestProject(t, c, "complete")
+	broken := newProjectWithoutRootReference(t, s, c, "broken")
+
+	projects, err := rex.FindProjectsWithoutRootReference(c, c.User.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0].ID != broken.ID {
+		t.Fatalf("got projects %+v, want only %s", projects, broken.ID)
+	}
+
+	var creates int
+	e := rex.Chain(c, func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "POST" && req.URL.Path == "/api/v2/rexReferences" {
+				creates++
+			}
+			return next.Execute(req)
+		})
+	})
+	address := &rex.ProjectAddress{City: "Graz", Country: "Austria"}
+	link, created, err := rex.EnsureRootReference(e, broken.ID, address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || link == "" || creates != 1 {
+		t.Errorf("got link %q, created %v after %d requests, want a new root reference", link, created, creates)
+	}
+	ref, err := rex.GetReferenceByLink(c, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ref.RootReference || ref.Address == nil || ref.Address.City != "Graz" {
+		t.Errorf("got reference %+v, want the root reference with the address", ref)
+	}
+
+	// The second call does not change anything
+	again, created, err := rex.EnsureRootReference(e, broken.ID, address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || again != link || creates != 1 {
+		t.Errorf("second call: got link %q, created %v after %d requests, want %q", again, created, creates, link)
+	}
+	if _, created, err = rex.EnsureRootReference(e, complete.ID, address, nil); err != nil || created || creates != 1 {
+		t.Errorf("complete project: got created %v, error %v", created, err)
+	}
+
+	if projects, err = rex.FindProjectsWithoutRootReference(c, c.User.UserID); err != nil || len(projects) != 0 {
+		t.Errorf("got projects %+v and error %v after the repair, want none", projects, err)
+	}
+	if broken, err = rex.GetProject(c, broken.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(broken.Embedded.RexReferences) != 1 {
+		t.Errorf("got %d references, want only the root reference", len(broken.Embedded.RexReferences))
+	}
+}
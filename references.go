@@ -0,0 +1,339 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+var (
+	apiReferenceByKey = "/api/v2/rexReferences/search/findByKey?key="
+)
+
+// ReferenceList is a list of Reference objects.
+//
+// Mainly required for JSON encoding/decoding
+type ReferenceList struct {
+	Embedded struct {
+		RexReferences []Reference `json:"rexReferences"`
+	} `json:"_embedded"`
+}
+
+// ReferenceUpdate contains the reference properties which should be changed.
+// Only the fields which are not nil (or not empty) are sent to the server.
+type ReferenceUpdate struct {
+	ParentReference string                 `json:"parentReference,omitempty"` // Self link of the new parent
+	Address         *ProjectAddress        `json:"address,omitempty"`
+	AbsTransform    *ProjectTransformation `json:"absoluteTransformation,omitempty"`
+	RelTransform    *ProjectTransformation `json:"relativeTransformation,omitempty"`
+	FileTransform   *FileTransformation    `json:"fileTransformation,omitempty"`
+}
+
+// ReferenceTree is a node in the spatial hierarchy of a project. The root node of the
+// tree is the root reference of the project.
+type ReferenceTree struct {
+	Reference Reference
+	Parent    *ReferenceTree   // nil for the root node
+	Children  []*ReferenceTree // all child references
+}
+
+// GetReference retrieves the reference with the given key (UUID).
+func GetReference(e Executor, key string) (*Reference, error) {
+	return GetReferenceContext(context.Background(), e, key)
+}
+
+// GetReferenceContext is like GetReference but uses the given context for the request.
+func GetReferenceContext(ctx context.Context, e Executor, key string) (*Reference, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	return GetReferenceByLinkContext(ctx, e, base+apiReferenceByKey+url.QueryEscape(key))
+}
+
+// GetReferenceByLink retrieves the reference using its self link (or any other link
+// which points to a single reference, e.g. the parentReference link).
+func GetReferenceByLink(e Executor, link string) (*Reference, error) {
+	return GetReferenceByLinkContext(context.Background(), e, link)
+}
+
+// GetReferenceByLinkContext is like GetReferenceByLink but uses the given context for the request.
+func GetReferenceByLinkContext(ctx context.Context, e Executor, link string) (*Reference, error) {
+	var r Reference
+	if err := getJSON(ctx, e, link, &r); err != nil {
+		return nil, err
+	}
+	r.setID()
+	return &r, nil
+}
+
+// GetProjectReferences retrieves all references of the project specified by the projectID (e.g. 1020).
+func GetProjectReferences(e Executor, projectID string) ([]Reference, error) {
+	return GetProjectReferencesContext(context.Background(), e, projectID)
+}
+
+// GetProjectReferencesContext is like GetProjectReferences but uses the given context for the request.
+func GetProjectReferencesContext(ctx context.Context, e Executor, projectID string) ([]Reference, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	return getReferenceList(ctx, e, base+apiProject+projectID+"/rexReferences")
+}
+
+// GetParentReference retrieves the parent of the given reference. The reference
+// must have been retrieved from the REX API. The root reference does not have a parent,
+// in this case an APIError with status 404 is returned.
+func GetParentReference(e Executor, r *Reference) (*Reference, error) {
+	return GetParentReferenceContext(context.Background(), e, r)
+}
+
+// GetParentReferenceContext is like GetParentReference but uses the given context for the request.
+func GetParentReferenceContext(ctx context.Context, e Executor, r *Reference) (*Reference, error) {
+	if r.Links == nil {
+		return nil, fmt.Errorf("reference %s has no links", r.Key)
+	}
+	return GetReferenceByLinkContext(ctx, e, r.Links.ParentReference.Href)
+}
+
+// GetChildReferences retrieves the children of the given reference. The reference
+// must have been retrieved from the REX API.
+func GetChildReferences(e Executor, r *Reference) ([]Reference, error) {
+	return GetChildReferencesContext(context.Background(), e, r)
+}
+
+// GetChildReferencesContext is like GetChildReferences but uses the given context for the request.
+func GetChildReferencesContext(ctx context.Context, e Executor, r *Reference) ([]Reference, error) {
+	if r.Links == nil {
+		return nil, fmt.Errorf("reference %s has no links", r.Key)
+	}
+	return getReferenceList(ctx, e, r.Links.ChildReferences.Href)
+}
+
+// UpdateReference changes the parent, the address or the transformations of the reference
+// identified by its self link and returns the updated reference.
+func UpdateReference(e Executor, selfLink string, update *ReferenceUpdate) (*Reference, error) {
+	return UpdateReferenceContext(context.Background(), e, selfLink, update)
+}
+
+// UpdateReferenceContext is like UpdateReference but uses the given context for all requests.
+func UpdateReferenceContext(ctx context.Context, e Executor, selfLink string, update *ReferenceUpdate) (*Reference, error) {
+	var r Reference
+	if err := patchJSON(ctx, e, selfLink, update, &r); err != nil {
+		return nil, err
+	}
+	r.setID()
+	return &r, nil
+}
+
+// DeleteReference removes the reference identified by its self link. A reference
+// can only be removed if it has neither child references nor project files.
+func DeleteReference(e Executor, selfLink string) error {
+	return DeleteReferenceContext(context.Background(), e, selfLink)
+}
+
+// DeleteReferenceContext is like DeleteReference but uses the given context for the request.
+func DeleteReferenceContext(ctx context.Context, e Executor, selfLink string) error {
+	return deleteLink(ctx, e, selfLink)
+}
+
+// GetProjectFileReference retrieves the reference of the project file specified by the fileID (e.g. 1044).
+func GetProjectFileReference(e Executor, fileID string) (*Reference, error) {
+	return GetProjectFileReferenceContext(context.Background(), e, fileID)
+}
+
+// GetProjectFileReferenceContext is like GetProjectFileReference but uses the given context for the request.
+func GetProjectFileReferenceContext(ctx context.Context, e Executor, fileID string) (*Reference, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	return GetReferenceByLinkContext(ctx, e, base+apiProjectFiles+fileID+"/rexReference")
+}
+
+// MoveProjectFile attaches the project file specified by the fileID (e.g. 1044) to another
+// reference of the project specified by the projectID (e.g. 1020). The file content is not
+// uploaded again.
+//
+// The reference of the file is re-parented under the reference identified by
+// parentReferenceLink. If transform is not nil, the file transformation is changed as well.
+// The updated reference of the file is returned.
+func MoveProjectFile(e Executor, projectID, fileID, parentReferenceLink string, transform *FileTransformation) (*Reference, error) {
+	return MoveProjectFileContext(context.Background(), e, projectID, fileID, parentReferenceLink, transform)
+}
+
+// MoveProjectFileContext is like MoveProjectFile but uses the given context for all requests.
+func MoveProjectFileContext(ctx context.Context, e Executor, projectID, fileID, parentReferenceLink string, transform *FileTransformation) (*Reference, error) {
+	fileRef, err := GetProjectFileReferenceContext(ctx, e, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure that the new parent is part of the same project and not attached to the file itself
+	tree, err := GetReferenceTreeContext(ctx, e, projectID)
+	if err != nil {
+		return nil, err
+	}
+	node := tree.FindByLink(fileRef.Links.Self.Href)
+	if node == nil {
+		return nil, fmt.Errorf("project file %s is not part of project %s", fileID, projectID)
+	}
+	parent := tree.FindByLink(parentReferenceLink)
+	if parent == nil {
+		return nil, fmt.Errorf("reference %s is not part of project %s", parentReferenceLink, projectID)
+	}
+	if node.Find(parent.Reference.Key) != nil {
+		return nil, fmt.Errorf("reference %s cannot be attached to itself or its descendants", parentReferenceLink)
+	}
+
+	update := &ReferenceUpdate{
+		ParentReference: parent.Reference.Links.Self.Href,
+		FileTransform:   transform,
+	}
+	return UpdateReferenceContext(ctx, e, fileRef.Links.Self.Href, update)
+}
+
+// SetProjectFileTransform changes the file transformation of the project file specified by the
+// fileID (e.g. 1044) without uploading the file content again. The updated reference is returned.
+func SetProjectFileTransform(e Executor, fileID string, transform *FileTransformation) (*Reference, error) {
+	return SetProjectFileTransformContext(context.Background(), e, fileID, transform)
+}
+
+// SetProjectFileTransformContext is like SetProjectFileTransform but uses the given context for all requests.
+func SetProjectFileTransformContext(ctx context.Context, e Executor, fileID string, transform *FileTransformation) (*Reference, error) {
+	fileRef, err := GetProjectFileReferenceContext(ctx, e, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return UpdateReferenceContext(ctx, e, fileRef.Links.Self.Href, &ReferenceUpdate{FileTransform: transform})
+}
+
+// GetReferenceTree loads the whole spatial hierarchy of the project specified by the
+// projectID (e.g. 1020), starting with the root reference.
+func GetReferenceTree(e Executor, projectID string) (*ReferenceTree, error) {
+	return GetReferenceTreeContext(context.Background(), e, projectID)
+}
+
+// GetReferenceTreeContext is like GetReferenceTree but uses the given context for all requests.
+func GetReferenceTreeContext(ctx context.Context, e Executor, projectID string) (*ReferenceTree, error) {
+	rootLink, err := getRootReferenceLink(ctx, e, projectID)
+	if err != nil {
+		return nil, err
+	}
+	root, err := GetReferenceByLinkContext(ctx, e, rootLink)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &ReferenceTree{Reference: *root}
+	if err = loadChildren(ctx, e, tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// loadChildren recursively loads all children of the node
+func loadChildren(ctx context.Context, e Executor, node *ReferenceTree) error {
+	children, err := GetChildReferencesContext(ctx, e, &node.Reference)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		childNode := &ReferenceTree{Reference: child, Parent: node}
+		if err = loadChildren(ctx, e, childNode); err != nil {
+			return err
+		}
+		node.Children = append(node.Children, childNode)
+	}
+	return nil
+}
+
+// Walk calls fn for the node and all its descendants (depth first). The depth of the
+// node itself is 0. If fn returns an error, the walk is stopped and the error is returned.
+func (t *ReferenceTree) Walk(fn func(node *ReferenceTree, depth int) error) error {
+	return t.walk(fn, 0)
+}
+
+func (t *ReferenceTree) walk(fn func(node *ReferenceTree, depth int) error, depth int) error {
+	if err := fn(t, depth); err != nil {
+		return err
+	}
+	for _, child := range t.Children {
+		if err := child.walk(fn, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkPostOrder calls fn for all descendants of the node before the node itself, hence
+// children are visited before their parents
+func (t *ReferenceTree) walkPostOrder(fn func(node *ReferenceTree) error) error {
+	for _, child := range t.Children {
+		if err := child.walkPostOrder(fn); err != nil {
+			return err
+		}
+	}
+	return fn(t)
+}
+
+// Find returns the node of the reference with the given key, or nil if the key is not
+// part of the tree.
+func (t *ReferenceTree) Find(key string) *ReferenceTree {
+	if t.Reference.Key == key {
+		return t
+	}
+	for _, child := range t.Children {
+		if node := child.Find(key); node != nil {
+			return node
+		}
+	}
+	return nil
+}
+
+// FindByLink returns the node of the reference with the given self link, or nil if the
+// reference is not part of the tree.
+func (t *ReferenceTree) FindByLink(selfLink string) *ReferenceTree {
+	id := referenceIDFromLink(selfLink)
+	var found *ReferenceTree
+	t.Walk(func(node *ReferenceTree, depth int) error {
+		if found == nil && node.Reference.ID == id {
+			found = node
+		}
+		return nil
+	})
+	return found
+}
+
+// getReferenceList fetches a list of references
+func getReferenceList(ctx context.Context, e Executor, link string) ([]Reference, error) {
+	var list ReferenceList
+	if err := getJSON(ctx, e, link, &list); err != nil {
+		return nil, err
+	}
+	refs := list.Embedded.RexReferences
+	for i := range refs {
+		refs[i].setID()
+	}
+	return refs, nil
+}
+
+// setID sets the ID for convenience
+func (r *Reference) setID() {
+	if r.Links != nil {
+		r.ID = referenceIDFromLink(r.Links.Self.Href)
+	}
+}
+
+// referenceIDFromLink extracts the reference ID from a reference self link
+func referenceIDFromLink(link string) string {
+	re, _ := regexp.Compile("/rexReferences/([^/?{]*)")
+	values := re.FindStringSubmatch(link)
+	if len(values) > 0 {
+		return values[1]
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+// newFileReference uploads a project file and returns its reference, which is a child of the root reference
+func newFileReference(t *testing.T, c *rex.Client, projectID, name string) (fileID string, ref *rex.Reference) {
+	t.Helper()
+	result, err := rex.UploadProjectFileWithResult(c, projectID, name, name+".obj", nil, strings.NewReader("v 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref, err = rex.GetProjectFileReference(c, result.ProjectFile.ID); err != nil {
+		t.Fatal(err)
+	}
+	return result.ProjectFile.ID, ref
+}
+
+// childKeys returns the sorted keys of the children of r
+func childKeys(t *testing.T, c *rex.Client, r *rex.Reference) []string {
+	t.Helper()
+	children, err := rex.GetChildReferences(c, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, child := range children {
+		keys = append(keys, child.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestGetReference(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "references")
+	_, a := newFileReference(t, c, p.ID, "a")
+
+	r, err := rex.GetReference(c, a.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != a.ID || r.Key != a.Key || r.RootReference || r.Links.Self.Href != a.Links.Self.Href {
+		t.Errorf("got reference %+v, want %+v", r, a)
+	}
+
+	if _, err = rex.GetReference(c, "00000000-0000-0000-0000-000000000000"); !rex.IsNotFound(err) {
+		t.Errorf("unknown key: got error %v, want status 404", err)
+	}
+	if _, err = rex.GetReferenceByLink(c, a.Links.Self.Href+"0"); !rex.IsNotFound(err) {
+		t.Errorf("unknown link: got error %v, want status 404", err)
+	}
+}
+
+func TestGetParentAndChildReferences(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "references")
+	_, a := newFileReference(t, c, p.ID, "a")
+	_, b := newFileReference(t, c, p.ID, "b")
+
+	root, err := rex.GetParentReference(c, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.RootReference {
+		t.Errorf("got parent %+v, want the root reference", root)
+	}
+	if _, err = rex.GetParentReference(c, root); !rex.IsNotFound(err) {
+		t.Errorf("root reference: got error %v, want status 404", err)
+	}
+	if _, err = rex.GetParentReference(c, &rex.Reference{Key: a.Key}); err == nil {
+		t.Error("got the parent of a reference without links")
+	}
+
+	want := []string{a.Key, b.Key}
+	sort.Strings(want)
+	if got := childKeys(t, c, root); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got children %v, want %v", got, want)
+	}
+	if got := childKeys(t, c, a); len(got) != 0 {
+		t.Errorf("got children %v, want none", got)
+	}
+}
+
+func TestUpdateReference(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "references")
+	_, a := newFileReference(t, c, p.ID, "a")
+	_, b := newFileReference(t, c, p.ID, "b")
+
+	rel := &rex.ProjectTransformation{}
+	rel.Position.Coordinates = []float64{1, 2, 3}
+	update := &rex.ReferenceUpdate{
+		ParentReference: a.Links.Self.Href,
+		Address:         &rex.ProjectAddress{City: "Graz"},
+		RelTransform:    rel,
+	}
+	r, err := rex.UpdateReference(c, b.Links.Self.Href, update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != b.ID || r.Address == nil || r.Address.City != "Graz" || r.RelTransform == nil || len(r.RelTransform.Position.Coordinates) != 3 {
+		t.Errorf("got reference %+v", r)
+	}
+	if got := childKeys(t, c, a); len(got) != 1 || got[0] != b.Key {
+		t.Errorf("got children %v of the new parent, want %s", got, b.Key)
+	}
+	parent, err := rex.GetParentReference(c, r)
+	if err != nil || parent.Key != a.Key {
+		t.Errorf("got parent %v and error %v, want %s", parent, err, a.Key)
+	}
+
+	// Fields which are not set are kept
+	r, err = rex.UpdateReference(c, b.Links.Self.Href, &rex.ReferenceUpdate{Address: &rex.ProjectAddress{City: "Wien"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Address.City != "Wien" || r.RelTransform == nil || r.RelTransform.Position.Coordinates[2] != 3 {
+		t.Errorf("got reference %+v after the second update", r)
+	}
+
+	if _, err = rex.UpdateReference(c, b.Links.Self.Href+"0", update); !rex.IsNotFound(err) {
+		t.Errorf("unknown reference: got error %v, want status 404", err)
+	}
+}
+
+func TestDeleteReference(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "references")
+	_, a := newFileReference(t, c, p.ID, "a")
+	fileID, b := newFileReference(t, c, p.ID, "b")
+
+	// A reference with a project file cannot be removed
+	var apiErr *rex.APIError
+	if err := rex.DeleteReference(c, b.Links.Self.Href); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("got error %v, want status 409", err)
+	}
+	if err := rex.DeleteProjectFile(c, fileID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rex.DeleteReference(c, b.Links.Self.Href); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rex.GetReferenceByLink(c, b.Links.Self.Href); !rex.IsNotFound(err) {
+		t.Errorf("got error %v for the removed reference, want status 404", err)
+	}
+	if err := rex.DeleteReference(c, b.Links.Self.Href); !rex.IsNotFound(err) {
+		t.Errorf("second delete: got error %v, want status 404", err)
+	}
+
+	// The other reference is not affected
+	if _, err := rex.GetReferenceByLink(c, a.Links.Self.Href); err != nil {
+		t.Error(err)
+	}
+}
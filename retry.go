@@ -0,0 +1,181 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRetryStatus contains the HTTP status codes which are retried by default.
+var DefaultRetryStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryExecutor wraps an Executor and retries failed requests using an exponential
+// backoff with jitter. If the server sends a Retry-After header, it is respected.
+//
+// Only idempotent requests are retried, which are GET, HEAD, OPTIONS, PUT and DELETE
+// requests, but also requests carrying an Idempotency-Key header and requests which are
+// known to be idempotent by this package (e.g. the file upload).
+// A request body must be replayable using http.Request.GetBody, which is automatically the
+// case for requests created with a bytes.Buffer, bytes.Reader or strings.Reader.
+//
+// To use the RetryExecutor simply wrap the client
+//
+//	e := NewRetryExecutor(client)
+//	project, err := GetProject(e, "1020")
+type RetryExecutor struct {
+	Executor    Executor      // Performs the actual request
+	MaxRetries  int           // Maximum number of retries after the first attempt
+	MinBackoff  time.Duration // Backoff before the first retry, doubled for every further retry
+	MaxBackoff  time.Duration // Upper limit of the backoff, also for Retry-After
+	RetryStatus []int         // Response status codes which are retried
+	RetryErrors bool          // Retry network errors (e.g. connection reset)
+}
+
+// NewRetryExecutor creates a new RetryExecutor with 3 retries, a backoff between 500ms
+// and 30s, which retries all network errors and the DefaultRetryStatus codes.
+func NewRetryExecutor(e Executor) *RetryExecutor {
+	return &RetryExecutor{
+		Executor:    e,
+		MaxRetries:  3,
+		MinBackoff:  500 * time.Millisecond,
+		MaxBackoff:  30 * time.Second,
+		RetryStatus: DefaultRetryStatus,
+		RetryErrors: true,
+	}
+}
+
+// Execute fullfills the Executor interface and performs the request, including retries.
+func (r *RetryExecutor) Execute(req *http.Request) (*http.Response, error) {
+
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	retryable := replayable && isIdempotent(req)
+
+	for attempt := 0; ; attempt++ {
+
+		// Every attempt gets its own copy, since executors may modify the headers
+		attemptReq := req.Clone(req.Context())
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		resp, err := r.Executor.Execute(attemptReq)
+		if !retryable || attempt >= r.MaxRetries || !r.shouldRetry(req, resp, err) {
+			return resp, err
+		}
+
+		wait := r.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// BaseURL fullfills the BaseURLProvider interface and returns the base URL of the wrapped executor
+func (r *RetryExecutor) BaseURL() string {
+	u, _ := baseURL(r.Executor)
+	return u
+}
+
+func (r *RetryExecutor) shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return r.RetryErrors && req.Context().Err() == nil
+	}
+	for _, status := range r.RetryStatus {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the time to wait before the next attempt
+func (r *RetryExecutor) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return r.limit(wait)
+		}
+	}
+
+	wait := r.MinBackoff
+	for i := 0; i < attempt && r.limit(wait) == wait; i++ {
+		wait *= 2
+	}
+	wait = r.limit(wait)
+
+	// Add jitter in order to avoid that all clients retry at the same time
+	if wait > 0 {
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+	return wait
+}
+
+// parseRetryAfter parses the Retry-After header, which is either given in seconds or as HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		wait := time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+type idempotentKey struct{}
+
+// withIdempotent marks all requests using the returned context as idempotent, e.g. a POST
+// request which replaces the content of a project file
+func withIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// isIdempotent returns true if the request can be sent multiple times without side effects
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	if req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	idempotent, _ := req.Context().Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// limit caps the duration at MaxBackoff, if MaxBackoff is set
+func (r *RetryExecutor) limit(d time.Duration) time.Duration {
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		return r.MaxBackoff
+	}
+	return d
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+		ok    bool
+	}{
+		{"", 0, 0, false},
+		{"0", 0, 0, true},
+		{"120", 120 * time.Second, 120 * time.Second, true},
+		{"-1", 0, 0, false},
+		{"soon", 0, 0, false},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute, true},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0, true},
+	}
+	for _, tt := range tests {
+		wait, ok := parseRetryAfter(tt.value)
+		if ok != tt.ok || wait < tt.min || wait > tt.max {
+			t.Errorf("%q: got %v, %v, want between %v and %v, %v", tt.value, wait, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	r := &RetryExecutor{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	// The backoff is doubled for every attempt up to MaxBackoff, the jitter takes up to half of it
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		for i := 0; i < 100; i++ {
+			if wait := r.backoff(attempt, nil); wait < want/2 || wait > want {
+				t.Fatalf("attempt %d: got backoff %v, want between %v and %v", attempt, wait, want/2, want)
+			}
+		}
+	}
+
+	// Retry-After is used without jitter, but limited by MaxBackoff
+	for value, want := range map[string]time.Duration{"0": 0, "1": time.Second, "60": time.Second} {
+		resp := &http.Response{Header: http.Header{"Retry-After": {value}}}
+		if wait := r.backoff(0, resp); wait != want {
+			t.Errorf("Retry-After %s: got backoff %v, want %v", value, wait, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/breiting/rex"
+)
+
+// newRetryExecutor returns a RetryExecutor without noticeable backoff and a counter of all attempts
+func newRetryExecutor(c *rex.Client) (*rex.RetryExecutor, *int) {
+	var attempts int
+	counting := rex.Chain(c, func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return next.Execute(req)
+		})
+	})
+	r := rex.NewRetryExecutor(counting)
+	r.MinBackoff = time.Millisecond
+	r.MaxBackoff = 10 * time.Millisecond
+	return r, &attempts
+}
+
+func TestRetryUpload(t *testing.T) {
+	s, c := newTestClient(t)
+	p := newTestProject(t, c, "retry")
+	f, err := rex.UploadProjectFileWithResult(c, p.ID, "model", "model.obj", nil, strings.NewReader("v 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The upload is a POST request, which is retried since it replaces the content
+	var uploads []http.Header
+	e, _ := newRetryExecutor(c)
+	e.Executor = rex.Chain(e.Executor, func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "POST" {
+				uploads = append(uploads, req.Header.Clone())
+			}
+			return next.Execute(req)
+		})
+	})
+	s.FailRequests("POST", "/api/v2/projectFiles/"+f.ProjectFile.ID+"/file", http.StatusServiceUnavailable, 1)
+
+	content := "v 1 1 1\n"
+	if err := rex.ReplaceProjectFileContent(e, f.ProjectFile.ID, "model.obj", strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads) != 2 {
+		t.Errorf("got %d upload attempts, want 2", len(uploads))
+	}
+	for _, h := range uploads {
+		if _, ok := h["Idempotency-Key"]; ok {
+			t.Error("upload has been sent with an Idempotency-Key header")
+		}
+	}
+
+	var b bytes.Buffer
+	if _, err := rex.DownloadFileTo(c, f.ProjectFile.Links.FileDownload.Href, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != content {
+		t.Errorf("got content %q, want %q", b.String(), content)
+	}
+}
+
+func TestRetryNotIdempotent(t *testing.T) {
+	s, c := newTestClient(t)
+
+	e, attempts := newRetryExecutor(c)
+	s.FailRequests("POST", "/api/v2/projects", http.StatusServiceUnavailable, 1)
+	if _, err := rex.CreateProject(e, c.User.UserID, "retry", nil, nil); err == nil {
+		t.Fatal("CreateProject has been retried")
+	}
+	if *attempts != 1 {
+		t.Errorf("got %d attempts, want 1", *attempts)
+	}
+}
+
+// serviceUnavailable returns a middleware which answers the first n requests with status 503
+// and the given Retry-After header
+func serviceUnavailable(n int, retryAfter string) rex.Middleware {
+	return func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if n <= 0 {
+				return next.Execute(req)
+			}
+			n--
+			header := http.Header{}
+			if retryAfter != "" {
+				header.Set("Retry-After", retryAfter)
+			}
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Status:     "503 Service Unavailable",
+				Header:     header,
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Request:    req,
+			}, nil
+		})
+	}
+}
+
+func TestRetryStatus(t *testing.T) {
+	s, c := newTestClient(t)
+	p := newTestProject(t, c, "retry")
+
+	e, attempts := newRetryExecutor(c)
+	s.FailRequests("GET", "/api/v2/projects/"+p.ID, http.StatusServiceUnavailable, 2)
+	if _, err := rex.GetProject(e, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	if *attempts != 3 {
+		t.Errorf("got %d attempts, want 3", *attempts)
+	}
+
+	// Give up after MaxRetries
+	*attempts = 0
+	s.FailRequests("GET", "/api/v2/projects/"+p.ID, http.StatusServiceUnavailable, e.MaxRetries+1)
+	var apiErr *rex.APIError
+	if _, err := rex.GetProject(e, p.ID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got error %v, want status 503", err)
+	}
+	if *attempts != e.MaxRetries+1 {
+		t.Errorf("got %d attempts, want %d", *attempts, e.MaxRetries+1)
+	}
+
+	// Other errors are not retried
+	*attempts = 0
+	s.FailRequests("GET", "/api/v2/projects/"+p.ID, http.StatusInternalServerError, 1)
+	if _, err := rex.GetProject(e, p.ID); err == nil {
+		t.Error("status 500 has been retried")
+	}
+	if *attempts != 1 {
+		t.Errorf("got %d attempts, want 1", *attempts)
+	}
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	_, c := newTestClient(t)
+
+	for _, retryErrors := range []bool{true, false} {
+		failures := 1
+		e, _ := newRetryExecutor(c)
+		e.RetryErrors = retryErrors
+		e.Executor = rex.Chain(e.Executor, func(next rex.Executor) rex.Executor {
+			return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+				if failures > 0 {
+					failures--
+					return nil, errors.New("connection reset")
+				}
+				return next.Execute(req)
+			})
+		})
+		if _, err := rex.GetCurrentUser(e); (err == nil) != retryErrors {
+			t.Errorf("RetryErrors %v: got error %v", retryErrors, err)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	_, c := newTestClient(t)
+
+	// Retry-After exceeds MaxBackoff, hence the client waits exactly MaxBackoff instead of the
+	// exponential backoff, which is at most MinBackoff for the first retry
+	for _, retryAfter := range []string{"120", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)} {
+		e, _ := newRetryExecutor(c)
+		e.MaxBackoff = 50 * time.Millisecond
+		e.Executor = rex.Chain(e.Executor, serviceUnavailable(1, retryAfter))
+
+		start := time.Now()
+		if _, err := rex.GetCurrentUser(e); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < e.MaxBackoff {
+			t.Errorf("Retry-After %s: retried after %v, want %v", retryAfter, elapsed, e.MaxBackoff)
+		}
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	_, c := newTestClient(t)
+
+	e, _ := newRetryExecutor(c)
+	e.MaxBackoff = 0
+	e.Executor = rex.Chain(e.Executor, serviceUnavailable(1, "3600"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := rex.GetCurrentUserContext(ctx, e); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -12,7 +12,41 @@
 // accessing the REX system.
 package rex
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
 // Global variables
 var (
-	RexBaseURL = "https://rex.robotic-eyes.com" // hostname for accessing REX cloud services
+	// RexBaseURL is the default hostname for accessing REX cloud services. It is used
+	// by all executors which do not implement BaseURLProvider.
+	RexBaseURL = "https://rex.robotic-eyes.com"
 )
+
+// ErrNoBaseURL is returned if an Executor implements BaseURLProvider but does not provide
+// a base URL, e.g. a bare ExecutorFunc (see ExecutorWithBaseURL).
+var ErrNoBaseURL = errors.New("executor does not provide a REX base URL")
+
+// BaseURLProvider is an optional interface for an Executor which talks to a specific
+// REX instance (e.g. staging, production or a test server). The Client implements
+// this interface, see WithBaseURL.
+type BaseURLProvider interface {
+	BaseURL() string
+}
+
+// baseURL returns the REX base URL which should be used for the executor. Only executors
+// which do not implement BaseURLProvider use RexBaseURL, an executor which implements the
+// interface but returns an empty base URL is an error.
+func baseURL(e Executor) (string, error) {
+	p, ok := e.(BaseURLProvider)
+	if !ok {
+		return RexBaseURL, nil
+	}
+	u := p.BaseURL()
+	if u == "" {
+		return "", fmt.Errorf("%w: %T", ErrNoBaseURL, e)
+	}
+	return strings.TrimSuffix(u, "/"), nil
+}
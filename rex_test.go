@@ -0,0 +1,47 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+func TestBaseURL(t *testing.T) {
+	s, c := newTestClient(t)
+
+	var requests int
+	fn := rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		return c.Execute(req)
+	})
+
+	tests := []struct {
+		name string
+		e    rex.Executor
+		err  error
+	}{
+		{"client", c, nil},
+		{"bare ExecutorFunc", fn, rex.ErrNoBaseURL},
+		{"ExecutorWithBaseURL", rex.ExecutorWithBaseURL(fn, s.URL+"/"), nil},
+		{"Chain", rex.Chain(c, rex.UserAgentMiddleware("test")), nil},
+		{"middleware without Chain", rex.UserAgentMiddleware("test")(c), nil},
+		{"middleware around ExecutorFunc", rex.UserAgentMiddleware("test")(fn), rex.ErrNoBaseURL},
+		{"RetryExecutor", rex.NewRetryExecutor(c), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests = 0
+			_, err := rex.GetCurrentUser(tt.e)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if tt.err != nil && requests != 0 {
+				t.Errorf("%d requests have been sent without a base URL", requests)
+			}
+		})
+	}
+}
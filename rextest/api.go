@@ -0,0 +1,1008 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rextest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/breiting/rex"
+)
+
+// routes registers all REX API endpoints which are supported by the fake server
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /oauth/token", s.locked(s.handleToken))
+
+	mux.HandleFunc("GET /api/v2/users", s.authenticated(s.getUsers))
+	mux.HandleFunc("GET /api/v2/users/current", s.authenticated(s.getCurrentUser))
+	mux.HandleFunc("GET /api/v2/users/search/findUserIdByEmail", s.authenticated(s.findUserIDByEmail))
+	mux.HandleFunc("GET /api/v2/users/search/findByUserId", s.authenticated(s.findUserByID))
+	mux.HandleFunc("GET /api/v2/users/{id}", s.authenticated(s.getUser))
+
+	mux.HandleFunc("POST /api/v2/projects", s.authenticated(s.createProject))
+	mux.HandleFunc("GET /api/v2/projects/{id}", s.authenticated(s.getProject))
+	mux.HandleFunc("PATCH /api/v2/projects/{id}", s.authenticated(s.updateProject))
+	mux.HandleFunc("DELETE /api/v2/projects/{id}", s.authenticated(s.deleteProject))
+	mux.HandleFunc("GET /api/v2/projects/{id}/rootRexReference", s.authenticated(s.getRootReference))
+	mux.HandleFunc("GET /api/v2/projects/{id}/rexReferences", s.authenticated(s.getProjectReferences))
+	mux.HandleFunc("GET /api/v2/projects/search/findAllByOwner", s.authenticated(s.findProjectsByOwner))
+
+	mux.HandleFunc("POST /api/v2/rexReferences", s.authenticated(s.createReference))
+	mux.HandleFunc("GET /api/v2/rexReferences/{id}", s.authenticated(s.getReference))
+	mux.HandleFunc("PATCH /api/v2/rexReferences/{id}", s.authenticated(s.updateReference))
+	mux.HandleFunc("DELETE /api/v2/rexReferences/{id}", s.authenticated(s.deleteReference))
+	mux.HandleFunc("GET /api/v2/rexReferences/{id}/project", s.authenticated(s.getReferenceProject))
+	mux.HandleFunc("GET /api/v2/rexReferences/{id}/parentReference", s.authenticated(s.getParentReference))
+	mux.HandleFunc("GET /api/v2/rexReferences/{id}/childReferences", s.authenticated(s.getChildReferences))
+	mux.HandleFunc("GET /api/v2/rexReferences/search/findByKey", s.authenticated(s.findReferenceByKey))
+
+	mux.HandleFunc("POST /api/v2/projectFiles/{$}", s.authenticated(s.createProjectFile))
+	mux.HandleFunc("POST /api/v2/projectFiles", s.authenticated(s.createProjectFile))
+	mux.HandleFunc("GET /api/v2/projectFiles/{id}", s.authenticated(s.getProjectFile))
+	mux.HandleFunc("PATCH /api/v2/projectFiles/{id}", s.authenticated(s.updateProjectFile))
+	mux.HandleFunc("DELETE /api/v2/projectFiles/{id}", s.authenticated(s.deleteProjectFile))
+	mux.HandleFunc("GET /api/v2/projectFiles/{id}/rexReference", s.authenticated(s.getProjectFileReference))
+	mux.HandleFunc("GET /api/v2/projectFiles/{id}/project", s.authenticated(s.getProjectFileProject))
+	mux.HandleFunc("POST /api/v2/projectFiles/{id}/file", s.authenticated(s.uploadFile))
+	mux.HandleFunc("GET /api/v2/projectFiles/{id}/file", s.authenticated(s.downloadFile))
+	mux.HandleFunc("POST /api/v2/projectFiles/{id}/uploads", s.authenticated(s.createUpload))
+	mux.HandleFunc("GET /api/v2/projectFiles/{id}/uploads/{upload}", s.authenticated(s.getUpload))
+	mux.HandleFunc("PUT /api/v2/projectFiles/{id}/uploads/{upload}/chunks/{index}", s.authenticated(s.uploadChunk))
+	mux.HandleFunc("POST /api/v2/projectFiles/{id}/uploads/{upload}/complete", s.authenticated(s.completeUpload))
+
+	return mux
+}
+
+//
+// Users
+//
+
+func (s *Server) getUsers(w http.ResponseWriter, r *http.Request, _ *user) {
+	ids := make([]string, 0, len(s.users))
+	for id := range s.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	items := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, s.userJSON(s.users[id]))
+	}
+	s.writePage(w, r, "users", items)
+}
+
+func (s *Server) getCurrentUser(w http.ResponseWriter, r *http.Request, u *user) {
+	writeJSON(w, http.StatusOK, s.userJSON(u))
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request, _ *user) {
+	u, ok := s.users[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.userJSON(u))
+}
+
+func (s *Server) findUserIDByEmail(w http.ResponseWriter, r *http.Request, _ *user) {
+	email := r.URL.Query().Get("email")
+	for _, u := range s.users {
+		if u.Email == email {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"userId": u.UserID})
+			return
+		}
+	}
+	writeError(w, r, http.StatusNotFound, "User not found")
+}
+
+func (s *Server) findUserByID(w http.ResponseWriter, r *http.Request, _ *user) {
+	u, ok := s.users[r.URL.Query().Get("userId")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.userJSON(u))
+}
+
+func (s *Server) userJSON(u *user) map[string]interface{} {
+	self := s.link("/api/v2/users/" + u.UserID)
+	return map[string]interface{}{
+		"userId":    u.UserID,
+		"username":  u.Username,
+		"email":     u.Email,
+		"firstName": u.FirstName,
+		"lastName":  u.LastName,
+		"lastLogin": u.LastLogin,
+		"roles":     u.Roles,
+		"_links": map[string]interface{}{
+			"self": href(self),
+			"user": href(self),
+		},
+	}
+}
+
+//
+// Projects
+//
+
+func (s *Server) createProject(w http.ResponseWriter, r *http.Request, u *user) {
+	var body struct {
+		Name        string `json:"name"`
+		Owner       string `json:"owner"`
+		TagLine     string `json:"tagLine"`
+		Type        string `json:"type"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Name == "" {
+		writeError(w, r, http.StatusBadRequest, "Project name must not be empty")
+		return
+	}
+	if body.Owner == "" {
+		body.Owner = u.UserID
+	}
+
+	now := time.Now()
+	p := &project{
+		ID:          s.newID(),
+		Name:        body.Name,
+		Owner:       body.Owner,
+		TagLine:     body.TagLine,
+		Type:        body.Type,
+		Description: body.Description,
+		CreatedBy:   u.UserID,
+		UpdatedBy:   u.UserID,
+		DateCreated: now,
+		LastUpdated: now,
+	}
+	s.projects[p.ID] = p
+	writeJSON(w, http.StatusCreated, s.projectJSON(p, false))
+}
+
+func (s *Server) getProject(w http.ResponseWriter, r *http.Request, _ *user) {
+	p, ok := s.projects[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.projectJSON(p, true))
+}
+
+func (s *Server) updateProject(w http.ResponseWriter, r *http.Request, u *user) {
+	p, ok := s.projects[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project not found")
+		return
+	}
+	var body struct {
+		Name        *string `json:"name"`
+		TagLine     *string `json:"tagLine"`
+		Type        *string `json:"type"`
+		Description *string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Name != nil {
+		if *body.Name == "" {
+			writeError(w, r, http.StatusBadRequest, "Project name must not be empty")
+			return
+		}
+		p.Name = *body.Name
+	}
+	if body.TagLine != nil {
+		p.TagLine = *body.TagLine
+	}
+	if body.Type != nil {
+		p.Type = *body.Type
+	}
+	if body.Description != nil {
+		p.Description = *body.Description
+	}
+	p.UpdatedBy = u.UserID
+	p.LastUpdated = time.Now()
+	writeJSON(w, http.StatusOK, s.projectJSON(p, true))
+}
+
+// deleteProject removes a project. Like the REX server, a project which still has
+// references or files cannot be removed.
+func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request, _ *user) {
+	p, ok := s.projects[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project not found")
+		return
+	}
+	if len(s.projectReferences(p.ID)) > 0 || len(s.projectFiles(p.ID)) > 0 {
+		writeError(w, r, http.StatusConflict, "Project still has references or files")
+		return
+	}
+	delete(s.projects, p.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getRootReference(w http.ResponseWriter, r *http.Request, _ *user) {
+	p, ok := s.projects[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project not found")
+		return
+	}
+	root := s.rootReference(p.ID)
+	if root == nil {
+		writeError(w, r, http.StatusNotFound, "Root reference not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.referenceJSON(root))
+}
+
+func (s *Server) findProjectsByOwner(w http.ResponseWriter, r *http.Request, _ *user) {
+	owner := r.URL.Query().Get("owner")
+
+	var projects []*project
+	for _, p := range s.projects {
+		if p.Owner == owner {
+			projects = append(projects, p)
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return lessID(projects[i].ID, projects[j].ID) })
+	if err := sortProjects(projects, r.URL.Query()["sort"]); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	items := make([]interface{}, 0, len(projects))
+	for _, p := range projects {
+		items = append(items, s.projectJSON(p, false))
+	}
+	s.writePage(w, r, "projects", items)
+}
+
+// sortProjects sorts the projects by the given criteria in the format property[,asc|desc].
+// The first criteria has the highest priority.
+func sortProjects(projects []*project, criteria []string) error {
+	for i := len(criteria) - 1; i >= 0; i-- {
+		parts := strings.Split(criteria[i], ",")
+		desc := len(parts) > 1 && strings.EqualFold(parts[1], "desc")
+
+		var less func(a, b *project) bool
+		switch parts[0] {
+		case "name":
+			less = func(a, b *project) bool { return a.Name < b.Name }
+		case "owner":
+			less = func(a, b *project) bool { return a.Owner < b.Owner }
+		case "type":
+			less = func(a, b *project) bool { return a.Type < b.Type }
+		case "dateCreated":
+			less = func(a, b *project) bool { return a.DateCreated.Before(b.DateCreated) }
+		case "lastUpdated":
+			less = func(a, b *project) bool { return a.LastUpdated.Before(b.LastUpdated) }
+		case "id":
+			less = func(a, b *project) bool { return lessID(a.ID, b.ID) }
+		default:
+			return fmt.Errorf("No property %s found for type Project", parts[0])
+		}
+		sort.SliceStable(projects, func(i, j int) bool {
+			if desc {
+				return less(projects[j], projects[i])
+			}
+			return less(projects[i], projects[j])
+		})
+	}
+	return nil
+}
+
+// rootReference returns the root reference of the project or nil
+func (s *Server) rootReference(projectID string) *reference {
+	for _, ref := range s.references {
+		if ref.ProjectID == projectID && ref.RootReference {
+			return ref
+		}
+	}
+	return nil
+}
+
+// projectJSON returns the HAL representation of the project. If embedded is set,
+// the root reference, all references and all project files are embedded.
+func (s *Server) projectJSON(p *project, embedded bool) map[string]interface{} {
+	self := s.link("/api/v2/projects/" + p.ID)
+	m := map[string]interface{}{
+		"name":        p.Name,
+		"owner":       p.Owner,
+		"tagLine":     p.TagLine,
+		"type":        p.Type,
+		"description": p.Description,
+		"createdBy":   p.CreatedBy,
+		"updatedBy":   p.UpdatedBy,
+		"dateCreated": p.DateCreated.Format(time.RFC3339),
+		"lastUpdated": p.LastUpdated.Format(time.RFC3339),
+		"_links": map[string]interface{}{
+			"self":               href(self),
+			"project":            templated(self + "{?projection}"),
+			"rootRexReference":   href(self + "/rootRexReference"),
+			"projectFiles":       href(self + "/projectFiles"),
+			"rexReferences":      href(self + "/rexReferences"),
+			"thumbnail.upload":   href(self + "/thumbnail"),
+			"thumbnail.download": href(self + "/thumbnail"),
+		},
+	}
+	if !embedded {
+		return m
+	}
+
+	refs := make([]interface{}, 0)
+	for _, ref := range s.projectReferences(p.ID) {
+		refs = append(refs, s.referenceJSON(ref))
+	}
+	files := make([]interface{}, 0)
+	for _, f := range s.projectFiles(p.ID) {
+		files = append(files, s.fileJSON(f))
+	}
+	e := map[string]interface{}{
+		"rexReferences": refs,
+		"projectFiles":  files,
+	}
+	if root := s.rootReference(p.ID); root != nil {
+		e["rootRexReference"] = s.referenceJSON(root)
+	}
+	m["_embedded"] = e
+	return m
+}
+
+//
+// RexReferences
+//
+
+func (s *Server) createReference(w http.ResponseWriter, r *http.Request, _ *user) {
+	var body rex.Reference
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Key == "" {
+		writeError(w, r, http.StatusBadRequest, "Reference key must not be empty")
+		return
+	}
+	projectID := idFromLink(body.Project, "projects")
+	if _, ok := s.projects[projectID]; !ok {
+		writeError(w, r, http.StatusBadRequest, "Unknown project "+body.Project)
+		return
+	}
+	if body.RootReference && s.rootReference(projectID) != nil {
+		writeError(w, r, http.StatusConflict, "Project already has a root reference")
+		return
+	}
+
+	ref := &reference{
+		ID:        s.newID(),
+		ProjectID: projectID,
+		Reference: body,
+	}
+	if body.ParentReference != "" {
+		parent, ok := s.references[idFromLink(body.ParentReference, "rexReferences")]
+		if !ok || parent.ProjectID != projectID {
+			writeError(w, r, http.StatusBadRequest, "Unknown parent reference "+body.ParentReference)
+			return
+		}
+		ref.ParentID = parent.ID
+	}
+	s.references[ref.ID] = ref
+	writeJSON(w, http.StatusCreated, s.referenceJSON(ref))
+}
+
+func (s *Server) getReference(w http.ResponseWriter, r *http.Request, _ *user) {
+	ref, ok := s.references[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Reference not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.referenceJSON(ref))
+}
+
+func (s *Server) updateReference(w http.ResponseWriter, r *http.Request, _ *user) {
+	ref, ok := s.references[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Reference not found")
+		return
+	}
+	var body struct {
+		ParentReference *string                    `json:"parentReference"`
+		Address         *rex.ProjectAddress        `json:"address"`
+		AbsTransform    *rex.ProjectTransformation `json:"absoluteTransformation"`
+		RelTransform    *rex.ProjectTransformation `json:"relativeTransformation"`
+		FileTransform   *rex.FileTransformation    `json:"fileTransformation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.ParentReference != nil {
+		parent, ok := s.references[idFromLink(*body.ParentReference, "rexReferences")]
+		if !ok || parent.ProjectID != ref.ProjectID {
+			writeError(w, r, http.StatusBadRequest, "Unknown parent reference "+*body.ParentReference)
+			return
+		}
+		for p := parent; p != nil; p = s.references[p.ParentID] {
+			if p.ID == ref.ID {
+				writeError(w, r, http.StatusBadRequest, "Reference cannot be attached to itself or its descendants")
+				return
+			}
+		}
+		ref.ParentID = parent.ID
+	}
+	if body.Address != nil {
+		ref.Address = body.Address
+	}
+	if body.AbsTransform != nil {
+		ref.AbsTransform = body.AbsTransform
+	}
+	if body.RelTransform != nil {
+		ref.RelTransform = body.RelTransform
+	}
+	if body.FileTransform != nil {
+		ref.FileTransform = body.FileTransform
+	}
+	writeJSON(w, http.StatusOK, s.referenceJSON(ref))
+}
+
+func (s *Server) getReferenceProject(w http.ResponseWriter, r *http.Request, _ *user) {
+	ref, ok := s.references[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Reference not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.projectJSON(s.projects[ref.ProjectID], false))
+}
+
+func (s *Server) getParentReference(w http.ResponseWriter, r *http.Request, _ *user) {
+	ref, ok := s.references[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Reference not found")
+		return
+	}
+	parent, ok := s.references[ref.ParentID]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Reference has no parent")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.referenceJSON(parent))
+}
+
+func (s *Server) getChildReferences(w http.ResponseWriter, r *http.Request, _ *user) {
+	ref, ok := s.references[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Reference not found")
+		return
+	}
+	var children []*reference
+	for _, child := range s.projectReferences(ref.ProjectID) {
+		if child.ParentID == ref.ID {
+			children = append(children, child)
+		}
+	}
+	s.writeReferences(w, r, children)
+}
+
+func (s *Server) getProjectReferences(w http.ResponseWriter, r *http.Request, _ *user) {
+	p, ok := s.projects[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project not found")
+		return
+	}
+	s.writeReferences(w, r, s.projectReferences(p.ID))
+}
+
+func (s *Server) findReferenceByKey(w http.ResponseWriter, r *http.Request, _ *user) {
+	key := r.URL.Query().Get("key")
+	for _, ref := range s.references {
+		if ref.Key == key {
+			writeJSON(w, http.StatusOK, s.referenceJSON(ref))
+			return
+		}
+	}
+	writeError(w, r, http.StatusNotFound, "Reference not found")
+}
+
+// writeReferences writes an unpaged list of references
+func (s *Server) writeReferences(w http.ResponseWriter, r *http.Request, refs []*reference) {
+	items := make([]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		items = append(items, s.referenceJSON(ref))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"_embedded": map[string]interface{}{
+			"rexReferences": items,
+		},
+		"_links": map[string]interface{}{
+			"self": href(s.link(r.URL.Path)),
+		},
+	})
+}
+
+// deleteReference removes a reference, which must not have any child references or files.
+func (s *Server) deleteReference(w http.ResponseWriter, r *http.Request, _ *user) {
+	ref, ok := s.references[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Reference not found")
+		return
+	}
+	for _, child := range s.references {
+		if child.ParentID == ref.ID {
+			writeError(w, r, http.StatusConflict, "Reference still has child references")
+			return
+		}
+	}
+	for _, f := range s.files {
+		if f.ReferenceID == ref.ID {
+			writeError(w, r, http.StatusConflict, "Reference still has project files")
+			return
+		}
+	}
+	delete(s.references, ref.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// projectReferences returns all references of the project sorted by ID
+func (s *Server) projectReferences(projectID string) []*reference {
+	var refs []*reference
+	for _, ref := range s.references {
+		if ref.ProjectID == projectID {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return lessID(refs[i].ID, refs[j].ID) })
+	return refs
+}
+
+func (s *Server) referenceJSON(ref *reference) map[string]interface{} {
+	self := s.link("/api/v2/rexReferences/" + ref.ID)
+	return map[string]interface{}{
+		"key":                    ref.Key,
+		"rootReference":          ref.RootReference,
+		"address":                ref.Address,
+		"absoluteTransformation": ref.AbsTransform,
+		"relativeTransformation": ref.RelTransform,
+		"fileTransformation":     ref.FileTransform,
+		"_links": map[string]interface{}{
+			"self":            href(self),
+			"rexReference":    templated(self + "{?projection}"),
+			"project":         href(self + "/project"),
+			"parentReference": href(self + "/parentReference"),
+			"childReferences": href(self + "/childReferences"),
+			"projectFiles":    href(self + "/projectFiles"),
+		},
+	}
+}
+
+//
+// Project files
+//
+
+func (s *Server) createProjectFile(w http.ResponseWriter, r *http.Request, _ *user) {
+	var body struct {
+		Name         string `json:"name"`
+		Type         string `json:"type"`
+		Project      string `json:"project"`
+		RexReference string `json:"rexReference"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	projectID := idFromLink(body.Project, "projects")
+	if _, ok := s.projects[projectID]; !ok {
+		writeError(w, r, http.StatusBadRequest, "Unknown project "+body.Project)
+		return
+	}
+	ref, ok := s.references[idFromLink(body.RexReference, "rexReferences")]
+	if !ok || ref.ProjectID != projectID {
+		writeError(w, r, http.StatusBadRequest, "Unknown reference "+body.RexReference)
+		return
+	}
+
+	f := &projectFile{
+		ID:           s.newID(),
+		ProjectID:    projectID,
+		ReferenceID:  ref.ID,
+		Name:         body.Name,
+		Type:         body.Type,
+		LastModified: time.Now(),
+	}
+	s.files[f.ID] = f
+	writeJSON(w, http.StatusCreated, s.fileJSON(f))
+}
+
+func (s *Server) getProjectFile(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fileJSON(f))
+}
+
+func (s *Server) updateProjectFile(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	var body struct {
+		Name *string `json:"name"`
+		Type *string `json:"type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Name != nil {
+		if *body.Name == "" {
+			writeError(w, r, http.StatusBadRequest, "Project file name must not be empty")
+			return
+		}
+		f.Name = *body.Name
+	}
+	if body.Type != nil {
+		f.Type = *body.Type
+	}
+	f.LastModified = time.Now()
+	writeJSON(w, http.StatusOK, s.fileJSON(f))
+}
+
+func (s *Server) deleteProjectFile(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	delete(s.files, f.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getProjectFileReference(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.referenceJSON(s.references[f.ReferenceID]))
+}
+
+func (s *Server) getProjectFileProject(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.projectJSON(s.projects[f.ProjectID], false))
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	part, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer part.Close()
+
+	content, err := ioutil.ReadAll(part)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	f.Content = content
+	f.FileName = header.Filename
+	f.ContentType = header.Header.Get("Content-Type")
+	f.LastModified = time.Now()
+	w.Header().Set("ETag", etag(f.Content))
+	writeJSON(w, http.StatusOK, s.fileJSON(f))
+}
+
+func (s *Server) downloadFile(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok || f.Content == nil {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	contentType := f.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", contentDisposition(f.FileName))
+	w.Header().Set("ETag", etag(f.Content))
+	if r.Header.Get("Range") == "" {
+		sum := md5.Sum(f.Content)
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	http.ServeContent(w, r, "", f.LastModified, bytes.NewReader(f.Content))
+}
+
+//
+// Resumable uploads: the content is uploaded in chunks to an upload session, which
+// replaces the file content when it is completed. This protocol is experimental and
+// not implemented by REX, see rex.UploadProjectFileResumable.
+//
+
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request, _ *user) {
+	f, ok := s.files[r.PathValue("id")]
+	if !ok || !s.ResumableUploads {
+		writeError(w, r, http.StatusNotFound, "Project file not found")
+		return
+	}
+	var body struct {
+		FileName    string `json:"fileName"`
+		ContentType string `json:"contentType"`
+		Size        int64  `json:"size"`
+		ChunkSize   int64  `json:"chunkSize"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Size < 0 {
+		writeError(w, r, http.StatusBadRequest, "Invalid size")
+		return
+	}
+	if body.ChunkSize <= 0 {
+		body.ChunkSize = 1 << 20
+	}
+	if body.ContentType == "" {
+		body.ContentType = "application/octet-stream"
+	}
+
+	u := &upload{
+		ID:          s.newID(),
+		FileID:      f.ID,
+		FileName:    body.FileName,
+		ContentType: body.ContentType,
+		Size:        body.Size,
+		ChunkSize:   body.ChunkSize,
+		Chunks:      make(map[int][]byte),
+	}
+	s.uploads[u.ID] = u
+	writeJSON(w, http.StatusCreated, s.uploadJSON(u))
+}
+
+func (s *Server) getUpload(w http.ResponseWriter, r *http.Request, _ *user) {
+	u, ok := s.upload(r)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Upload not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.uploadJSON(u))
+}
+
+func (s *Server) uploadChunk(w http.ResponseWriter, r *http.Request, _ *user) {
+	u, ok := s.upload(r)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Upload not found")
+		return
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 || int64(index)*u.ChunkSize >= u.Size {
+		writeError(w, r, http.StatusBadRequest, "Invalid chunk index")
+		return
+	}
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	length := u.Size - int64(index)*u.ChunkSize
+	if length > u.ChunkSize {
+		length = u.ChunkSize
+	}
+	if int64(len(content)) != length {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("Chunk %d must have %d bytes", index, length))
+		return
+	}
+	u.Chunks[index] = content
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, _ *user) {
+	u, ok := s.upload(r)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "Upload not found")
+		return
+	}
+	var content []byte
+	for i := 0; int64(i)*u.ChunkSize < u.Size; i++ {
+		chunk, ok := u.Chunks[i]
+		if !ok {
+			writeError(w, r, http.StatusConflict, fmt.Sprintf("Chunk %d is missing", i))
+			return
+		}
+		content = append(content, chunk...)
+	}
+
+	f := s.files[u.FileID]
+	f.Content = content
+	if f.Content == nil {
+		f.Content = []byte{}
+	}
+	f.FileName = u.FileName
+	f.ContentType = u.ContentType
+	f.LastModified = time.Now()
+	delete(s.uploads, u.ID)
+	w.Header().Set("ETag", etag(f.Content))
+	writeJSON(w, http.StatusOK, s.fileJSON(f))
+}
+
+// etag returns a strong entity tag of the content, which is its MD5 checksum
+func etag(content []byte) string {
+	sum := md5.Sum(content)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// upload returns the upload session of the request
+func (s *Server) upload(r *http.Request) (*upload, bool) {
+	u, ok := s.uploads[r.PathValue("upload")]
+	if !ok || u.FileID != r.PathValue("id") || s.files[u.FileID] == nil {
+		return nil, false
+	}
+	return u, true
+}
+
+func (s *Server) uploadJSON(u *upload) map[string]interface{} {
+	self := s.link("/api/v2/projectFiles/" + u.FileID + "/uploads/" + u.ID)
+	chunks := []int{}
+	for i := range u.Chunks {
+		chunks = append(chunks, i)
+	}
+	sort.Ints(chunks)
+
+	return map[string]interface{}{
+		"fileName":  u.FileName,
+		"size":      u.Size,
+		"chunkSize": u.ChunkSize,
+		"chunks":    chunks,
+		"_links": map[string]interface{}{
+			"self":     href(self),
+			"chunk":    templated(self + "/chunks/{index}"),
+			"complete": href(self + "/complete"),
+		},
+	}
+}
+
+// projectFiles returns all files of the project sorted by ID
+func (s *Server) projectFiles(projectID string) []*projectFile {
+	var files []*projectFile
+	for _, f := range s.files {
+		if f.ProjectID == projectID {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return lessID(files[i].ID, files[j].ID) })
+	return files
+}
+
+func (s *Server) fileJSON(f *projectFile) map[string]interface{} {
+	self := s.link("/api/v2/projectFiles/" + f.ID)
+	v := map[string]interface{}{
+		"name":         f.Name,
+		"type":         f.Type,
+		"fileSize":     len(f.Content),
+		"lastModified": f.LastModified.Format(time.RFC3339),
+		"_links": map[string]interface{}{
+			"self":          href(self),
+			"projectFile":   templated(self + "{?projection}"),
+			"project":       href(self + "/project"),
+			"rexReference":  href(self + "/rexReference"),
+			"file.upload":   href(self + "/file"),
+			"file.download": href(self + "/file"),
+		},
+	}
+	if s.ResumableUploads {
+		links := v["_links"].(map[string]interface{})
+		links["file.upload.resumable"] = href(self + "/uploads")
+	}
+	return v
+}
+
+//
+// Helpers
+//
+
+// writePage writes a single page of the items, as requested by the page and size
+// query parameters. The page number starts with 0, the default page size is 20.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, collection string, items []interface{}) {
+	q := r.URL.Query()
+	size, err := strconv.Atoi(q.Get("size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	if size > 2000 {
+		size = 2000
+	}
+	number, err := strconv.Atoi(q.Get("page"))
+	if err != nil || number < 0 {
+		number = 0
+	}
+
+	total := len(items)
+	totalPages := (total + size - 1) / size
+	start := min(number*size, total)
+	end := min(start+size, total)
+
+	pageLink := func(n int) map[string]interface{} {
+		q.Set("page", strconv.Itoa(n))
+		q.Set("size", strconv.Itoa(size))
+		return href(s.link(r.URL.Path) + "?" + q.Encode())
+	}
+	links := map[string]interface{}{
+		"self": pageLink(number),
+	}
+	if totalPages > 0 {
+		links["first"] = pageLink(0)
+		links["last"] = pageLink(totalPages - 1)
+	}
+	if number > 0 {
+		links["prev"] = pageLink(number - 1)
+	}
+	if number+1 < totalPages {
+		links["next"] = pageLink(number + 1)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"_embedded": map[string]interface{}{
+			collection: items[start:end],
+		},
+		"_links": links,
+		"page": map[string]interface{}{
+			"size":          size,
+			"totalElements": total,
+			"totalPages":    totalPages,
+			"number":        number,
+		},
+	})
+}
+
+// contentDisposition returns the attachment header as sent by the REX server. Filenames
+// which are not plain ASCII are encoded as filename* (RFC 5987).
+func contentDisposition(fileName string) string {
+	for _, c := range fileName {
+		if c > unicode.MaxASCII || c == '"' || c == '\\' {
+			return mime.FormatMediaType("attachment", map[string]string{"filename": fileName})
+		}
+	}
+	return `attachment; filename="` + fileName + `"`
+}
+
+func href(link string) map[string]interface{} {
+	return map[string]interface{}{"href": link}
+}
+
+func templated(link string) map[string]interface{} {
+	return map[string]interface{}{"href": link, "templated": true}
+}
+
+// lessID compares two numeric resource IDs
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
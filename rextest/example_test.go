@@ -0,0 +1,42 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rextest_test
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/breiting/rex"
+	"github.com/breiting/rex/rextest"
+)
+
+func ExampleServer() {
+
+	s := rextest.NewServer()
+	defer s.Close()
+
+	client, err := s.NewClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	project, err := rex.CreateProject(client, client.User.UserID, "Demo", nil, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = rex.UploadProjectFile(client, project.ID, "Model", "model.rex", nil, strings.NewReader("REX1 content"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	details, err := rex.GetProject(client, project.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(details.Name, len(details.Embedded.ProjectFiles), details.Embedded.ProjectFiles[0].Type)
+
+	// Output:
+	// Demo 1 rex
+}
@@ -0,0 +1,304 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+// Package rextest provides an in-process fake of the REX API for unit tests.
+//
+// The fake server keeps all users, projects, rexReferences and project files in memory,
+// hence a project which has been created using rex.CreateProject is returned by a
+// subsequent rex.GetProjects call. Only the parts of the REX API are implemented,
+// which are used by the rex package.
+//
+// A test typically starts a server and uses a client which is logged in to the server
+//
+//	s := rextest.NewServer()
+//	defer s.Close()
+//
+//	client, err := s.NewClient()
+//	project, err := rex.CreateProject(client, client.User.UserID, "test", nil, nil)
+package rextest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/breiting/rex"
+)
+
+// Default credentials and user which are registered by NewServer
+const (
+	ClientID     = "rextest-client-id"
+	ClientSecret = "rextest-client-secret"
+	UserID       = "rextest-user"
+)
+
+// Server is a fake REX server. All exported fields must not be modified after the first request.
+type Server struct {
+	*httptest.Server
+
+	TokenLifetime    time.Duration // Lifetime of an access token, defaults to one hour
+	ResumableUploads bool          // Announce the experimental resumable (chunked) uploads of project files, REX itself does not support them
+
+	mu          sync.Mutex
+	nextID      int
+	credentials map[string]credentials // client ID -> credentials
+	tokens      map[string]token       // access token -> token
+	users       map[string]*user       // user ID -> user
+	projects    map[string]*project    // ID -> project
+	references  map[string]*reference  // ID -> rexReference
+	files       map[string]*projectFile
+	uploads     map[string]*upload // ID -> resumable upload session
+	failures    []failure
+}
+
+type failure struct {
+	method string
+	path   string
+	status int
+	count  int
+}
+
+type credentials struct {
+	secret string
+	userID string
+}
+
+type token struct {
+	userID string
+	expiry time.Time
+}
+
+type user struct {
+	rex.User
+}
+
+type project struct {
+	ID          string
+	Name        string
+	Owner       string
+	TagLine     string
+	Type        string
+	Description string
+	CreatedBy   string
+	UpdatedBy   string
+	DateCreated time.Time
+	LastUpdated time.Time
+}
+
+type reference struct {
+	ID        string
+	ProjectID string
+	ParentID  string
+	rex.Reference
+}
+
+type projectFile struct {
+	ID           string
+	ProjectID    string
+	ReferenceID  string
+	Name         string
+	Type         string
+	FileName     string
+	ContentType  string
+	Content      []byte
+	LastModified time.Time
+}
+
+type upload struct {
+	ID          string
+	FileID      string
+	FileName    string
+	ContentType string
+	Size        int64
+	ChunkSize   int64
+	Chunks      map[int][]byte
+}
+
+// NewServer starts a new fake REX server. The server has a single user UserID, which can
+// be accessed using the ClientID and ClientSecret. The server must be closed by the caller.
+func NewServer() *Server {
+	s := &Server{
+		TokenLifetime: time.Hour,
+		nextID:        1000,
+		credentials:   make(map[string]credentials),
+		tokens:        make(map[string]token),
+		users:         make(map[string]*user),
+		projects:      make(map[string]*project),
+		references:    make(map[string]*reference),
+		files:         make(map[string]*projectFile),
+		uploads:       make(map[string]*upload),
+	}
+	s.AddUser(rex.User{
+		UserID:    UserID,
+		Username:  "rextest",
+		Email:     "rextest@example.com",
+		FirstName: "Rex",
+		LastName:  "Test",
+	}, ClientID, ClientSecret)
+
+	s.Server = httptest.NewServer(s.failing(s.routes()))
+	return s
+}
+
+// AddUser registers a new user which can log in using the given client credentials.
+func (s *Server) AddUser(u rex.User, clientID, clientSecret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[u.UserID] = &user{User: u}
+	s.credentials[clientID] = credentials{secret: clientSecret, userID: u.UserID}
+}
+
+// NewClient creates a new rex.Client for the server, which is logged in as UserID.
+func (s *Server) NewClient() (*rex.Client, error) {
+	c := rex.NewClient(s.Client(), rex.WithBaseURL(s.URL))
+	return c, c.Login(ClientID, ClientSecret)
+}
+
+// FailRequests lets the next n requests with the given method and path (e.g. /api/v2/rexReferences)
+// fail with the given status code. This can be used for testing error handling.
+func (s *Server) FailRequests(method, path string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failure{method: method, path: path, status: status, count: n})
+}
+
+// failing wraps the handler and answers requests registered by FailRequests with an error
+func (s *Server) failing(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		status := 0
+		for i, f := range s.failures {
+			if f.count > 0 && f.method == r.Method && f.path == r.URL.Path {
+				s.failures[i].count--
+				status = f.status
+				break
+			}
+		}
+		s.mu.Unlock()
+
+		if status != 0 {
+			writeError(w, r, status, "Injected failure")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// newID returns a new unique resource ID
+func (s *Server) newID() string {
+	s.nextID++
+	return strconv.Itoa(s.nextID)
+}
+
+// link returns the absolute URL for the given path
+func (s *Server) link(path string) string {
+	return s.URL + path
+}
+
+// locked wraps a handler, which is then called with the server lock held
+func (s *Server) locked(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		h(w, r)
+	}
+}
+
+// authenticated wraps a handler, which is only called if the request carries a valid
+// access token. The handler is called with the server lock held.
+func (s *Server) authenticated(h func(w http.ResponseWriter, r *http.Request, u *user)) http.HandlerFunc {
+	return s.locked(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(strings.ToLower(auth), "bearer ") {
+			writeError(w, r, http.StatusUnauthorized, "Full authentication is required to access this resource")
+			return
+		}
+		t, ok := s.tokens[auth[len("bearer "):]]
+		if !ok || time.Now().After(t.expiry) {
+			writeError(w, r, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+		h(w, r, s.users[t.userID])
+	})
+}
+
+// handleToken implements the client credentials grant
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := basicAuth(r)
+	c, known := s.credentials[clientID]
+	if !ok || !known || c.secret != clientSecret {
+		writeError(w, r, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+	r.ParseForm()
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeError(w, r, http.StatusBadRequest, "Unsupported grant type")
+		return
+	}
+
+	accessToken := "rextest-token-" + s.newID()
+	s.tokens[accessToken] = token{userID: c.userID, expiry: time.Now().Add(s.TokenLifetime)}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "bearer",
+		"expires_in":   int64(s.TokenLifetime / time.Second),
+		"scope":        "read write",
+	})
+}
+
+// basicAuth decodes the basic authorization header. Other than http.Request.BasicAuth
+// the header name is matched case-insensitive, as it is sent by rex.
+func basicAuth(r *http.Request) (string, string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(auth), "basic ") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(auth[len("basic "):])
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// writeJSON writes v as HAL JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/hal+json;charset=UTF-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format which is used by the REX server (Spring)
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"timestamp": time.Now().UnixNano() / int64(time.Millisecond),
+		"status":    status,
+		"error":     http.StatusText(status),
+		"message":   message,
+		"path":      r.URL.Path,
+	})
+}
+
+// idFromLink extracts the resource ID from a link such as https://host/api/v2/projects/1020.
+// The collection is the name of the resource collection (e.g. projects).
+func idFromLink(link, collection string) string {
+	i := strings.Index(link, "/"+collection+"/")
+	if i < 0 {
+		return ""
+	}
+	id := link[i+len(collection)+2:]
+	if j := strings.IndexAny(id, "/?{"); j >= 0 {
+		id = id[:j]
+	}
+	return id
+}
@@ -0,0 +1,370 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// Vector3 is a 3D vector, used for positions and scale factors.
+type Vector3 struct {
+	X, Y, Z float64
+}
+
+// Quaternion represents a rotation in 3D space. Use QuaternionFromEuler for creating
+// a quaternion from the rotation of a transformation.
+type Quaternion struct {
+	W, X, Y, Z float64
+}
+
+// Matrix4 is a 4x4 matrix in row-major order, used for affine transformations of
+// column vectors. The translation is stored in the elements 3, 7 and 11.
+type Matrix4 [16]float64
+
+// IdentityQuaternion returns the quaternion which does not rotate at all.
+func IdentityQuaternion() Quaternion {
+	return Quaternion{W: 1}
+}
+
+// QuaternionFromEuler creates a quaternion from Euler angles in radians.
+//
+// The rotations are applied in the order X, Y and Z around the fixed axes (roll, pitch
+// and yaw), which is the same as the rotation matrix Rz * Ry * Rx. This is the convention
+// of ROS REP 103 (https://www.ros.org/reps/rep-0103.html), which also uses radians.
+//
+// The rotation of ProjectTransformation and FileTransformation is assumed to use the same
+// convention, this has not been verified against the REX API. Convert the angles
+// accordingly if the data has been created using a different one.
+func QuaternionFromEuler(x, y, z float64) Quaternion {
+	cx, sx := math.Cos(x/2), math.Sin(x/2)
+	cy, sy := math.Cos(y/2), math.Sin(y/2)
+	cz, sz := math.Cos(z/2), math.Sin(z/2)
+
+	return Quaternion{
+		W: cz*cy*cx + sz*sy*sx,
+		X: cz*cy*sx - sz*sy*cx,
+		Y: cz*sy*cx + sz*cy*sx,
+		Z: sz*cy*cx - cz*sy*sx,
+	}
+}
+
+// Euler returns the Euler angles in radians (see QuaternionFromEuler for the convention).
+func (q Quaternion) Euler() (x, y, z float64) {
+	return q.Matrix().euler()
+}
+
+// Mul returns the quaternion q * r, which first rotates by r and then by q.
+func (q Quaternion) Mul(r Quaternion) Quaternion {
+	return Quaternion{
+		W: q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+		X: q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		Y: q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		Z: q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+	}
+}
+
+// Normalize returns the quaternion scaled to unit length.
+func (q Quaternion) Normalize() Quaternion {
+	n := math.Sqrt(q.W*q.W + q.X*q.X + q.Y*q.Y + q.Z*q.Z)
+	if n == 0 {
+		return IdentityQuaternion()
+	}
+	return Quaternion{W: q.W / n, X: q.X / n, Y: q.Y / n, Z: q.Z / n}
+}
+
+// Inverse returns the inverse rotation of the quaternion.
+func (q Quaternion) Inverse() Quaternion {
+	n := q.W*q.W + q.X*q.X + q.Y*q.Y + q.Z*q.Z
+	if n == 0 {
+		return IdentityQuaternion()
+	}
+	return Quaternion{W: q.W / n, X: -q.X / n, Y: -q.Y / n, Z: -q.Z / n}
+}
+
+// Rotate applies the rotation to the vector v.
+func (q Quaternion) Rotate(v Vector3) Vector3 {
+	return q.Matrix().TransformDirection(v)
+}
+
+// Matrix returns the rotation matrix of the (normalized) quaternion.
+func (q Quaternion) Matrix() Matrix4 {
+	q = q.Normalize()
+	w, x, y, z := q.W, q.X, q.Y, q.Z
+
+	return Matrix4{
+		1 - 2*(y*y+z*z), 2 * (x*y - w*z), 2 * (x*z + w*y), 0,
+		2 * (x*y + w*z), 1 - 2*(x*x+z*z), 2 * (y*z - w*x), 0,
+		2 * (x*z - w*y), 2 * (y*z + w*x), 1 - 2*(x*x+y*y), 0,
+		0, 0, 0, 1,
+	}
+}
+
+// IdentityMatrix returns the 4x4 identity matrix.
+func IdentityMatrix() Matrix4 {
+	return Matrix4{
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 1, 0,
+		0, 0, 0, 1,
+	}
+}
+
+// NewTransformMatrix creates a matrix which first scales, then rotates and finally translates.
+func NewTransformMatrix(translation Vector3, rotation Quaternion, scale Vector3) Matrix4 {
+	m := rotation.Matrix()
+	for row := 0; row < 3; row++ {
+		m[row*4+0] *= scale.X
+		m[row*4+1] *= scale.Y
+		m[row*4+2] *= scale.Z
+	}
+	m[3], m[7], m[11] = translation.X, translation.Y, translation.Z
+	return m
+}
+
+// Mul returns the matrix product m * n, which first applies n and then m.
+func (m Matrix4) Mul(n Matrix4) Matrix4 {
+	var r Matrix4
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			var sum float64
+			for k := 0; k < 4; k++ {
+				sum += m[row*4+k] * n[k*4+col]
+			}
+			r[row*4+col] = sum
+		}
+	}
+	return r
+}
+
+// Inverse returns the inverse of the affine transformation m. The last row of m must
+// be (0, 0, 0, 1). If m cannot be inverted, ok is false.
+func (m Matrix4) Inverse() (inv Matrix4, ok bool) {
+	a, b, c := m[0], m[1], m[2]
+	d, e, f := m[4], m[5], m[6]
+	g, h, i := m[8], m[9], m[10]
+
+	det := a*(e*i-f*h) - b*(d*i-f*g) + c*(d*h-e*g)
+	if math.Abs(det) < 1e-12 {
+		return Matrix4{}, false
+	}
+
+	inv = Matrix4{
+		(e*i - f*h) / det, (c*h - b*i) / det, (b*f - c*e) / det, 0,
+		(f*g - d*i) / det, (a*i - c*g) / det, (c*d - a*f) / det, 0,
+		(d*h - e*g) / det, (b*g - a*h) / det, (a*e - b*d) / det, 0,
+		0, 0, 0, 1,
+	}
+	t := inv.TransformDirection(Vector3{m[3], m[7], m[11]})
+	inv[3], inv[7], inv[11] = -t.X, -t.Y, -t.Z
+	return inv, true
+}
+
+// TransformPoint applies the transformation to the point p.
+func (m Matrix4) TransformPoint(p Vector3) Vector3 {
+	v := m.TransformDirection(p)
+	return Vector3{v.X + m[3], v.Y + m[7], v.Z + m[11]}
+}
+
+// TransformDirection applies the transformation to the direction v, the translation is ignored.
+func (m Matrix4) TransformDirection(v Vector3) Vector3 {
+	return Vector3{
+		m[0]*v.X + m[1]*v.Y + m[2]*v.Z,
+		m[4]*v.X + m[5]*v.Y + m[6]*v.Z,
+		m[8]*v.X + m[9]*v.Y + m[10]*v.Z,
+	}
+}
+
+// Decompose splits the affine transformation into translation, rotation and scale,
+// such that NewTransformMatrix(translation, rotation, scale) returns m again. Shearing
+// cannot be represented and is lost.
+func (m Matrix4) Decompose() (translation Vector3, rotation Quaternion, scale Vector3) {
+	translation = Vector3{m[3], m[7], m[11]}
+
+	scale = Vector3{
+		math.Sqrt(m[0]*m[0] + m[4]*m[4] + m[8]*m[8]),
+		math.Sqrt(m[1]*m[1] + m[5]*m[5] + m[9]*m[9]),
+		math.Sqrt(m[2]*m[2] + m[6]*m[6] + m[10]*m[10]),
+	}
+	det := m[0]*(m[5]*m[10]-m[6]*m[9]) - m[1]*(m[4]*m[10]-m[6]*m[8]) + m[2]*(m[4]*m[9]-m[5]*m[8])
+	if det < 0 {
+		scale.X = -scale.X
+	}
+	if scale.X == 0 || scale.Y == 0 || scale.Z == 0 {
+		return translation, IdentityQuaternion(), scale
+	}
+
+	var r Matrix4
+	for row := 0; row < 3; row++ {
+		r[row*4+0] = m[row*4+0] / scale.X
+		r[row*4+1] = m[row*4+1] / scale.Y
+		r[row*4+2] = m[row*4+2] / scale.Z
+	}
+	return translation, r.quaternion(), scale
+}
+
+// quaternion converts the rotation part of the matrix into a quaternion
+func (m Matrix4) quaternion() Quaternion {
+	trace := m[0] + m[5] + m[10]
+	var q Quaternion
+	switch {
+	case trace > 0:
+		s := math.Sqrt(trace+1) * 2
+		q = Quaternion{W: s / 4, X: (m[9] - m[6]) / s, Y: (m[2] - m[8]) / s, Z: (m[4] - m[1]) / s}
+	case m[0] > m[5] && m[0] > m[10]:
+		s := math.Sqrt(1+m[0]-m[5]-m[10]) * 2
+		q = Quaternion{W: (m[9] - m[6]) / s, X: s / 4, Y: (m[1] + m[4]) / s, Z: (m[2] + m[8]) / s}
+	case m[5] > m[10]:
+		s := math.Sqrt(1+m[5]-m[0]-m[10]) * 2
+		q = Quaternion{W: (m[2] - m[8]) / s, X: (m[1] + m[4]) / s, Y: s / 4, Z: (m[6] + m[9]) / s}
+	default:
+		s := math.Sqrt(1+m[10]-m[0]-m[5]) * 2
+		q = Quaternion{W: (m[4] - m[1]) / s, X: (m[2] + m[8]) / s, Y: (m[6] + m[9]) / s, Z: s / 4}
+	}
+	return q.Normalize()
+}
+
+// euler returns the Euler angles of the rotation part of the matrix
+func (m Matrix4) euler() (x, y, z float64) {
+	y = math.Asin(math.Max(-1, math.Min(1, -m[8])))
+	if math.Abs(m[8]) < 1-1e-9 {
+		x = math.Atan2(m[9], m[10])
+		z = math.Atan2(m[4], m[0])
+	} else {
+		// gimbal lock, the rotation around X and Z cannot be distinguished
+		x = 0
+		z = math.Atan2(-m[1], m[5])
+	}
+	return x, y, z
+}
+
+// Matrix returns the transformation matrix. The rotation is given in Euler angles
+// (radians, see QuaternionFromEuler), the position coordinates are used as translation.
+// A nil transformation returns the identity matrix.
+//
+// The position of an absoluteTransformation might be a GeoJSON point in degrees, which
+// cannot be used as translation. In this case the matrix is relative to the ENUFrame at
+// this position (see GetProjectENUFrame), hence it does not translate at all.
+func (t *ProjectTransformation) Matrix() Matrix4 {
+	if t == nil {
+		return IdentityMatrix()
+	}
+	rotation := QuaternionFromEuler(t.Rotation.X, t.Rotation.Y, t.Rotation.Z)
+	if t.Position.Type == GeoJSONPoint {
+		return rotation.Matrix()
+	}
+	return NewTransformMatrix(coordinates(t.Position.Coordinates), rotation, Vector3{1, 1, 1})
+}
+
+// SetMatrix sets rotation and position from the matrix. Scale and shearing are ignored.
+//
+// If the position is a GeoJSON point, the translation is given in the ENUFrame at this
+// position and the point is moved accordingly. The position is not changed if the point
+// is not a valid geo position.
+func (t *ProjectTransformation) SetMatrix(m Matrix4) {
+	translation, rotation, _ := m.Decompose()
+	t.Rotation.X, t.Rotation.Y, t.Rotation.Z = rotation.Euler()
+	if t.Position.Type != GeoJSONPoint {
+		t.Position.Coordinates = []float64{translation.X, translation.Y, translation.Z}
+		return
+	}
+	if translation == (Vector3{}) {
+		return
+	}
+	origin, err := t.GeoPosition()
+	if err != nil {
+		return
+	}
+	frame, err := NewENUFrame(origin)
+	if err != nil {
+		return
+	}
+	t.Position.Coordinates = frame.ToGeoPosition(translation).Coordinates()
+}
+
+// Matrix returns the transformation matrix. The rotation is given in Euler angles
+// (radians, see QuaternionFromEuler), the position coordinates are used as translation.
+// A scale of 0 (not set) is treated as 1. A nil transformation returns the identity matrix.
+func (t *FileTransformation) Matrix() Matrix4 {
+	if t == nil {
+		return IdentityMatrix()
+	}
+	scale := t.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	rotation := QuaternionFromEuler(t.Rotation.X, t.Rotation.Y, t.Rotation.Z)
+	return NewTransformMatrix(coordinates(t.Position.Coordinates), rotation, Vector3{scale, scale, scale})
+}
+
+// SetMatrix sets rotation, position and scale from the matrix. Since the file transformation
+// only supports uniform scaling, the average of the scale factors is used.
+func (t *FileTransformation) SetMatrix(m Matrix4) {
+	translation, rotation, scale := m.Decompose()
+	t.Rotation.X, t.Rotation.Y, t.Rotation.Z = rotation.Euler()
+	t.Position.Coordinates = []float64{translation.X, translation.Y, translation.Z}
+	t.Scale = (math.Abs(scale.X) + math.Abs(scale.Y) + math.Abs(scale.Z)) / 3
+}
+
+// coordinates converts position coordinates into a vector, missing coordinates are 0
+func coordinates(c []float64) Vector3 {
+	var v Vector3
+	if len(c) > 0 {
+		v.X = c[0]
+	}
+	if len(c) > 1 {
+		v.Y = c[1]
+	}
+	if len(c) > 2 {
+		v.Z = c[2]
+	}
+	return v
+}
+
+// WorldMatrix returns the transformation of the reference relative to the project. It is
+// composed of the absoluteTransformation of the root reference and the
+// relativeTransformation of all references down to this one.
+//
+// If the root reference is positioned using a GeoJSON point, the result is relative to the
+// ENUFrame of the project (see GetProjectENUFrame and ProjectTransformation.Matrix).
+func (t *ReferenceTree) WorldMatrix() Matrix4 {
+	if t.Parent == nil {
+		return t.Reference.AbsTransform.Matrix()
+	}
+	return t.Parent.WorldMatrix().Mul(t.Reference.RelTransform.Matrix())
+}
+
+// FileWorldMatrix returns the transformation of a file attached to this reference, which
+// is the WorldMatrix combined with the fileTransformation of the reference.
+func (t *ReferenceTree) FileWorldMatrix() Matrix4 {
+	return t.WorldMatrix().Mul(t.Reference.FileTransform.Matrix())
+}
+
+// GetProjectFileWorldTransform computes the effective transformation of the project file
+// specified by the fileID (e.g. 1044) within the project specified by the projectID (e.g. 1020).
+//
+// The transformation is composed of the absoluteTransformation of the root reference,
+// the relativeTransformation of all references down to the file and the fileTransformation.
+// For geo-referenced projects, it is relative to the ENUFrame of the project (see WorldMatrix).
+func GetProjectFileWorldTransform(e Executor, projectID, fileID string) (Matrix4, error) {
+	return GetProjectFileWorldTransformContext(context.Background(), e, projectID, fileID)
+}
+
+// GetProjectFileWorldTransformContext is like GetProjectFileWorldTransform but uses the
+// given context for all requests.
+func GetProjectFileWorldTransformContext(ctx context.Context, e Executor, projectID, fileID string) (Matrix4, error) {
+	fileRef, err := GetProjectFileReferenceContext(ctx, e, fileID)
+	if err != nil {
+		return Matrix4{}, err
+	}
+	tree, err := GetReferenceTreeContext(ctx, e, projectID)
+	if err != nil {
+		return Matrix4{}, err
+	}
+	node := tree.FindByLink(fileRef.Links.Self.Href)
+	if node == nil {
+		return Matrix4{}, fmt.Errorf("project file %s is not part of project %s", fileID, projectID)
+	}
+	return node.FileWorldMatrix(), nil
+}
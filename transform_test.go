@@ -0,0 +1,287 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/breiting/rex"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func nearVector(a, b rex.Vector3, tolerance float64) bool {
+	return near(a.X, b.X, tolerance) && near(a.Y, b.Y, tolerance) && near(a.Z, b.Z, tolerance)
+}
+
+func nearMatrix(a, b rex.Matrix4, tolerance float64) bool {
+	for i := range a {
+		if !near(a[i], b[i], tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRotation returns true if both quaternions describe the same rotation (q and -q are equal)
+func sameRotation(q, r rex.Quaternion) bool {
+	dot := q.W*r.W + q.X*r.X + q.Y*r.Y + q.Z*r.Z
+	return near(math.Abs(dot), 1, 1e-9)
+}
+
+// rotationMatrix returns Rz * Ry * Rx, built from the elementary rotations
+func rotationMatrix(x, y, z float64) rex.Matrix4 {
+	rx := rex.Matrix4{
+		1, 0, 0, 0,
+		0, math.Cos(x), -math.Sin(x), 0,
+		0, math.Sin(x), math.Cos(x), 0,
+		0, 0, 0, 1,
+	}
+	ry := rex.Matrix4{
+		math.Cos(y), 0, math.Sin(y), 0,
+		0, 1, 0, 0,
+		-math.Sin(y), 0, math.Cos(y), 0,
+		0, 0, 0, 1,
+	}
+	rz := rex.Matrix4{
+		math.Cos(z), -math.Sin(z), 0, 0,
+		math.Sin(z), math.Cos(z), 0, 0,
+		0, 0, 1, 0,
+		0, 0, 0, 1,
+	}
+	return rz.Mul(ry).Mul(rx)
+}
+
+func TestEulerRoundTrip(t *testing.T) {
+	angles := []float64{-3, -1.5, -0.4, 0, 0.3, 1.2, 3}
+	for _, x := range angles {
+		for _, y := range []float64{-1.5, -0.7, 0, 0.2, 1.5} {
+			for _, z := range angles {
+				q := rex.QuaternionFromEuler(x, y, z)
+				if !nearMatrix(q.Matrix(), rotationMatrix(x, y, z), 1e-12) {
+					t.Fatalf("(%v, %v, %v): quaternion matrix differs from Rz * Ry * Rx", x, y, z)
+				}
+
+				ex, ey, ez := q.Euler()
+				if !near(ex, x, 1e-9) || !near(ey, y, 1e-9) || !near(ez, z, 1e-9) {
+					t.Fatalf("(%v, %v, %v): got Euler angles (%v, %v, %v)", x, y, z, ex, ey, ez)
+				}
+
+				_, r, _ := q.Matrix().Decompose()
+				if !sameRotation(q, r) {
+					t.Fatalf("(%v, %v, %v): matrix returns quaternion %v, want %v", x, y, z, r, q)
+				}
+			}
+		}
+	}
+}
+
+func TestQuaternionRotate(t *testing.T) {
+	tests := []struct {
+		x, y, z float64
+		v, want rex.Vector3
+	}{
+		{0, 0, math.Pi / 2, rex.Vector3{X: 1}, rex.Vector3{Y: 1}},
+		{math.Pi / 2, 0, 0, rex.Vector3{Y: 1}, rex.Vector3{Z: 1}},
+		{0, math.Pi / 2, 0, rex.Vector3{Z: 1}, rex.Vector3{X: 1}},
+		// X is applied first: X turns Y into Z, Z does not change it
+		{math.Pi / 2, 0, math.Pi / 2, rex.Vector3{Y: 1}, rex.Vector3{Z: 1}},
+	}
+	for _, tt := range tests {
+		q := rex.QuaternionFromEuler(tt.x, tt.y, tt.z)
+		if got := q.Rotate(tt.v); !nearVector(got, tt.want, 1e-12) {
+			t.Errorf("(%v, %v, %v) rotates %v to %v, want %v", tt.x, tt.y, tt.z, tt.v, got, tt.want)
+		}
+		if got := q.Inverse().Rotate(tt.want); !nearVector(got, tt.v, 1e-12) {
+			t.Errorf("(%v, %v, %v): inverse rotates %v to %v, want %v", tt.x, tt.y, tt.z, tt.want, got, tt.v)
+		}
+	}
+}
+
+func TestMatrixInverse(t *testing.T) {
+	m := rex.NewTransformMatrix(rex.Vector3{X: 1, Y: -2, Z: 3}, rex.QuaternionFromEuler(0.3, -0.5, 1.1), rex.Vector3{X: 2, Y: 0.5, Z: 4})
+	inv, ok := m.Inverse()
+	if !ok {
+		t.Fatal("matrix cannot be inverted")
+	}
+	if !nearMatrix(m.Mul(inv), rex.IdentityMatrix(), 1e-12) || !nearMatrix(inv.Mul(m), rex.IdentityMatrix(), 1e-12) {
+		t.Errorf("m * inverse is not the identity: %v", m.Mul(inv))
+	}
+
+	p := rex.Vector3{X: 5, Y: 6, Z: 7}
+	if got := inv.TransformPoint(m.TransformPoint(p)); !nearVector(got, p, 1e-12) {
+		t.Errorf("got %v, want %v", got, p)
+	}
+
+	singular := rex.NewTransformMatrix(rex.Vector3{}, rex.IdentityQuaternion(), rex.Vector3{X: 1, Y: 0, Z: 1})
+	if _, ok = singular.Inverse(); ok {
+		t.Error("singular matrix has been inverted")
+	}
+}
+
+func TestMatrixDecompose(t *testing.T) {
+	tests := []struct {
+		translation rex.Vector3
+		rotation    rex.Quaternion
+		scale       rex.Vector3
+	}{
+		{rex.Vector3{}, rex.IdentityQuaternion(), rex.Vector3{X: 1, Y: 1, Z: 1}},
+		{rex.Vector3{X: 10, Y: -4, Z: 0.5}, rex.QuaternionFromEuler(0.1, 0.2, 0.3), rex.Vector3{X: 1, Y: 1, Z: 1}},
+		{rex.Vector3{X: -1, Y: 2, Z: -3}, rex.QuaternionFromEuler(-2.5, 1.2, 3), rex.Vector3{X: 2, Y: 3, Z: 0.25}},
+		{rex.Vector3{X: 7}, rex.QuaternionFromEuler(0, 0, math.Pi), rex.Vector3{X: -2, Y: 2, Z: 2}}, // mirrored
+	}
+	for _, tt := range tests {
+		m := rex.NewTransformMatrix(tt.translation, tt.rotation, tt.scale)
+		translation, rotation, scale := m.Decompose()
+		if !nearVector(translation, tt.translation, 1e-12) || !nearVector(scale, tt.scale, 1e-12) || !sameRotation(rotation, tt.rotation) {
+			t.Errorf("got (%v, %v, %v), want (%v, %v, %v)", translation, rotation, scale, tt.translation, tt.rotation, tt.scale)
+		}
+		if got := rex.NewTransformMatrix(translation, rotation, scale); !nearMatrix(got, m, 1e-12) {
+			t.Errorf("recomposed matrix %v, want %v", got, m)
+		}
+	}
+}
+
+func TestTransformationSetMatrix(t *testing.T) {
+	var ft rex.FileTransformation
+	m := rex.NewTransformMatrix(rex.Vector3{X: 1, Y: 2, Z: 3}, rex.QuaternionFromEuler(0.5, -0.25, 2), rex.Vector3{X: 3, Y: 3, Z: 3})
+	ft.SetMatrix(m)
+	if !nearMatrix(ft.Matrix(), m, 1e-12) {
+		t.Errorf("file transformation: got %v, want %v", ft.Matrix(), m)
+	}
+	if ft.Scale != 3 {
+		t.Errorf("got scale %v, want 3", ft.Scale)
+	}
+
+	var pt rex.ProjectTransformation
+	m = rex.NewTransformMatrix(rex.Vector3{X: -1, Z: 8}, rex.QuaternionFromEuler(0, 0, -1), rex.Vector3{X: 1, Y: 1, Z: 1})
+	pt.SetMatrix(m)
+	if !nearMatrix(pt.Matrix(), m, 1e-12) {
+		t.Errorf("project transformation: got %v, want %v", pt.Matrix(), m)
+	}
+
+	var unset *rex.FileTransformation
+	if unset.Matrix() != rex.IdentityMatrix() || (&rex.FileTransformation{}).Matrix() != rex.IdentityMatrix() {
+		t.Error("an unset file transformation is not the identity")
+	}
+}
+
+func TestWorldMatrix(t *testing.T) {
+	abs := &rex.ProjectTransformation{}
+	abs.Rotation.Z = math.Pi / 2
+	abs.Position.Coordinates = []float64{100, 0, 0}
+
+	childRel := &rex.ProjectTransformation{}
+	childRel.Position.Coordinates = []float64{1, 0, 0}
+
+	grandchildRel := &rex.ProjectTransformation{}
+	grandchildRel.Rotation.X = math.Pi / 2
+	grandchildRel.Position.Coordinates = []float64{0, 2, 0}
+
+	file := &rex.FileTransformation{Scale: 2}
+	file.Position.Coordinates = []float64{0, 0, 1}
+
+	// The file transformation of the child must not affect the grandchild
+	childFile := &rex.FileTransformation{Scale: 10}
+
+	root := &rex.ReferenceTree{Reference: rex.Reference{RootReference: true, AbsTransform: abs}}
+	child := &rex.ReferenceTree{Reference: rex.Reference{RelTransform: childRel, FileTransform: childFile}, Parent: root}
+	grandchild := &rex.ReferenceTree{Reference: rex.Reference{RelTransform: grandchildRel, FileTransform: file}, Parent: child}
+	root.Children = []*rex.ReferenceTree{child}
+	child.Children = []*rex.ReferenceTree{grandchild}
+
+	// origin -> (0, 2, 0) -> (1, 2, 0) -> (-2, 1, 0) + (100, 0, 0)
+	if got, want := grandchild.WorldMatrix().TransformPoint(rex.Vector3{}), (rex.Vector3{X: 98, Y: 1}); !nearVector(got, want, 1e-12) {
+		t.Errorf("world matrix: got %v, want %v", got, want)
+	}
+
+	// (1, 0, 0) -> scale and file position (2, 0, 1) -> rotation X (2, -1, 0) -> (2, 1, 0)
+	// -> (3, 1, 0) -> rotation Z (-1, 3, 0) -> (99, 3, 0)
+	if got, want := grandchild.FileWorldMatrix().TransformPoint(rex.Vector3{X: 1}), (rex.Vector3{X: 99, Y: 3}); !nearVector(got, want, 1e-12) {
+		t.Errorf("file world matrix: got %v, want %v", got, want)
+	}
+}
+
+func TestGetProjectFileWorldTransform(t *testing.T) {
+	_, c := newTestClient(t)
+
+	abs := &rex.ProjectTransformation{}
+	abs.Rotation.Z = math.Pi / 2
+	abs.Position.Type = "Point"
+	abs.Position.Coordinates = []float64{10, 20, 30}
+	p, err := rex.CreateProject(c, c.User.UserID, "transform", nil, abs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parentTransform := &rex.FileTransformation{Scale: 5}
+	parentTransform.Position.Coordinates = []float64{100, 100, 100}
+	parent, err := rex.UploadProjectFileWithResult(c, p.ID, "parent", "parent.obj", parentTransform, strings.NewReader("v 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileTransform := &rex.FileTransformation{Scale: 2}
+	fileTransform.Position.Coordinates = []float64{1, 0, 0}
+	f, err := rex.UploadProjectFileWithResult(c, p.ID, "file", "file.obj", fileTransform, strings.NewReader("v 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Attach the file to the reference of the other file, whose file transformation is not inherited
+	parentRef, err := rex.GetProjectFileReference(c, parent.ProjectFile.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rex.MoveProjectFile(c, p.ID, f.ProjectFile.ID, parentRef.Links.Self.Href, fileTransform); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := rex.GetProjectFileWorldTransform(c, p.ID, f.ProjectFile.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// (1, 0, 0) -> (3, 0, 0) -> rotation Z (0, 3, 0), the geo position is the origin of the ENU frame
+	if got, want := m.TransformPoint(rex.Vector3{X: 1}), (rex.Vector3{Y: 3}); !nearVector(got, want, 1e-12) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The world transformation can be converted into geo positions using the ENU frame,
+	// (0, 3, 0) is 3 meters north of the root reference
+	frame, err := rex.GetProjectENUFrame(c, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := frame.ToGeoPosition(m.TransformPoint(rex.Vector3{X: 1})); math.Abs(got.Longitude-10) > 1e-9 || got.Latitude <= 20 || math.Abs(got.Altitude-30) > 1e-6 {
+		t.Errorf("got point of the file at %+v, want it north of 10, 20, 30", got)
+	}
+}
+
+func TestGeoTransformationMatrix(t *testing.T) {
+	pt, err := rex.NewGeoTransformation(rex.GeoPosition{Longitude: 15.44, Latitude: 47.07, Altitude: 350})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt.Rotation.Z = math.Pi / 2
+
+	// The degrees are not used as translation
+	if got := pt.Matrix(); !nearMatrix(got, rex.QuaternionFromEuler(0, 0, math.Pi/2).Matrix(), 1e-12) {
+		t.Errorf("got %v, want the rotation only", got)
+	}
+
+	// Moving the transformation by 100 meters to the north moves the geo position
+	pt.SetMatrix(rex.NewTransformMatrix(rex.Vector3{Y: 100}, rex.IdentityQuaternion(), rex.Vector3{X: 1, Y: 1, Z: 1}))
+	p, err := pt.GeoPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(p.Longitude-15.44) > 1e-9 || math.Abs(p.Latitude-47.07-100/111132.0) > 1e-5 || math.Abs(p.Altitude-350) > 0.01 {
+		t.Errorf("got %+v, want a position 100 m north", p)
+	}
+	if pt.Rotation.Z != 0 {
+		t.Errorf("got rotation %v, want none", pt.Rotation.Z)
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UploadChunkSize is the chunk size in bytes, which is requested for resumable uploads.
+// The server may decide to use a different chunk size.
+//
+// Experimental: see UploadProjectFileResumable.
+var UploadChunkSize int64 = 8 << 20
+
+// uploadSession is a resumable upload as announced by the server
+type uploadSession struct {
+	FileName  string `json:"fileName"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunkSize"`
+	Chunks    []int  `json:"chunks"` // Indices of the chunks which have been received by the server
+	Links     struct {
+		Self struct {
+			Href string `json:"href"`
+		} `json:"self"`
+		Chunk struct {
+			Href string `json:"href"` // templated, e.g. .../chunks/{index}
+		} `json:"chunk"`
+		Complete struct {
+			Href string `json:"href"`
+		} `json:"complete"`
+	} `json:"_links"`
+}
+
+// uploadState is stored in the state file of a resumable upload
+type uploadState struct {
+	ProjectFile string         `json:"projectFile"` // Self link of the project file
+	Session     string         `json:"session"`     // Self link of the upload session
+	FileName    string         `json:"fileName"`
+	Size        int64          `json:"size"`
+	ChunkSize   int64          `json:"chunkSize"`
+	Chunks      map[int]string `json:"chunks"` // SHA-256 of the chunks which have been confirmed by the server, by index
+}
+
+// UploadProjectFileResumable is like UploadProjectFile, but uploads the content in chunks,
+// hence an interrupted upload can be continued.
+//
+// The state of the upload is stored in stateFile. If the upload fails, calling
+// UploadProjectFileResumable with the same stateFile continues the upload of the already
+// created project file, only the chunks which have not been confirmed by the server are
+// uploaded again. The content is always read from the beginning of r, if it has been changed
+// since the interruption, the whole content is uploaded again. The state file must belong to
+// an upload to the same project. It is removed as soon as the upload is complete.
+//
+// Resumable uploads are only used if the server announces them using the file.upload.resumable
+// link of the project file. Otherwise the content is uploaded at once like in UploadProjectFile.
+//
+// Experimental: the upload protocol (upload sessions, chunks and their completion) is not part
+// of the documented REX API, currently it is only implemented by the rextest server. It may
+// change or be removed. UploadProjectFile remains the way for uploading files to REX.
+func UploadProjectFileResumable(e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.ReadSeeker, stateFile string) error {
+	return UploadProjectFileResumableContext(context.Background(), e, projectID, name, fileName, transform, r, stateFile)
+}
+
+// UploadProjectFileResumableContext is like UploadProjectFileResumable but uses the given context
+// for all requests. Cancelling the context aborts a running upload, which can be continued later.
+func UploadProjectFileResumableContext(ctx context.Context, e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.ReadSeeker, stateFile string) error {
+	_, err := UploadProjectFileResumableWithResultContext(ctx, e, projectID, name, fileName, transform, r, stateFile)
+	return err
+}
+
+// UploadProjectFileResumableWithResult is like UploadProjectFileResumable, but returns the project
+// file as well as the checksums of the uploaded content.
+func UploadProjectFileResumableWithResult(e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.ReadSeeker, stateFile string) (*UploadResult, error) {
+	return UploadProjectFileResumableWithResultContext(context.Background(), e, projectID, name, fileName, transform, r, stateFile)
+}
+
+// UploadProjectFileResumableWithResultContext is like UploadProjectFileResumableWithResult but uses
+// the given context for all requests. Cancelling the context aborts a running upload, which can be
+// continued later.
+func UploadProjectFileResumableWithResultContext(ctx context.Context, e Executor, projectID string, name string, fileName string, transform *FileTransformation, r io.ReadSeeker, stateFile string) (*UploadResult, error) {
+	fileType, err := detectSeekerFileType(fileName, r)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadUploadState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var f *ProjectFile
+	if state != nil {
+		f, err = GetProjectFileContext(ctx, e, projectFileIDFromLink(state.ProjectFile))
+		if err != nil {
+			return nil, fmt.Errorf("cannot continue upload of %s: %w", state.ProjectFile, err)
+		}
+		id, err := projectFileProjectID(ctx, e, f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot continue upload of %s: %w", state.ProjectFile, err)
+		}
+		if id != projectID {
+			return nil, fmt.Errorf("state file %s belongs to the upload of %s in project %s", stateFile, state.ProjectFile, id)
+		}
+	} else {
+		f, err = createProjectFile(ctx, e, projectID, name, fileType.Type, transform)
+		if err != nil {
+			return nil, err
+		}
+
+		// Store the project file immediately, hence it is not created twice
+		state = &uploadState{ProjectFile: f.Links.Self.Href}
+		if err = saveUploadState(stateFile, state); err != nil {
+			return nil, err
+		}
+	}
+	return uploadResumable(ctx, e, f, fileName, fileType.ContentType, r, state, stateFile)
+}
+
+// ReplaceProjectFileContentResumable is like ReplaceProjectFileContent, but uploads the content
+// in chunks (see UploadProjectFileResumable).
+//
+// Experimental: like UploadProjectFileResumable.
+func ReplaceProjectFileContentResumable(e Executor, fileID string, fileName string, r io.ReadSeeker, stateFile string) error {
+	return ReplaceProjectFileContentResumableContext(context.Background(), e, fileID, fileName, r, stateFile)
+}
+
+// ReplaceProjectFileContentResumableContext is like ReplaceProjectFileContentResumable but uses the
+// given context for all requests. Cancelling the context aborts a running upload, which can be continued later.
+func ReplaceProjectFileContentResumableContext(ctx context.Context, e Executor, fileID string, fileName string, r io.ReadSeeker, stateFile string) error {
+	_, err := ReplaceProjectFileContentResumableWithResultContext(ctx, e, fileID, fileName, r, stateFile)
+	return err
+}
+
+// ReplaceProjectFileContentResumableWithResult is like ReplaceProjectFileContentResumable, but
+// returns the project file as well as the checksums of the uploaded content.
+func ReplaceProjectFileContentResumableWithResult(e Executor, fileID string, fileName string, r io.ReadSeeker, stateFile string) (*UploadResult, error) {
+	return ReplaceProjectFileContentResumableWithResultContext(context.Background(), e, fileID, fileName, r, stateFile)
+}
+
+// ReplaceProjectFileContentResumableWithResultContext is like ReplaceProjectFileContentResumableWithResult
+// but uses the given context for all requests. Cancelling the context aborts a running upload, which
+// can be continued later.
+func ReplaceProjectFileContentResumableWithResultContext(ctx context.Context, e Executor, fileID string, fileName string, r io.ReadSeeker, stateFile string) (*UploadResult, error) {
+	fileType, err := detectSeekerFileType(fileName, r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := GetProjectFileContext(ctx, e, fileID)
+	if err != nil {
+		return nil, err
+	}
+	if f.Links == nil {
+		return nil, fmt.Errorf("project file %s has no upload link", fileID)
+	}
+	if err = checkProjectFileType(f, fileType); err != nil {
+		return nil, err
+	}
+
+	state, err := loadUploadState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		state = &uploadState{ProjectFile: f.Links.Self.Href}
+	} else if projectFileIDFromLink(state.ProjectFile) != fileID {
+		return nil, fmt.Errorf("state file %s belongs to the upload of %s", stateFile, state.ProjectFile)
+	}
+	return uploadResumable(ctx, e, f, fileName, fileType.ContentType, r, state, stateFile)
+}
+
+// uploadResumable uploads all chunks which have not been confirmed yet and completes the upload
+func uploadResumable(ctx context.Context, e Executor, f *ProjectFile, fileName string, contentType string, r io.ReadSeeker, state *uploadState, stateFile string) (*UploadResult, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// The server does not support resumable uploads, fall back to a single upload
+	if f.Links.FileUploadResumable.Href == "" {
+		result, err := uploadFileContent(ctx, e, f.Links.FileUpload.Href, fileName, contentType, r)
+		if result == nil {
+			return nil, err
+		}
+		result.ProjectFile = f
+		if removeErr := removeFile(stateFile); err == nil {
+			err = removeErr
+		}
+		return result, err
+	}
+
+	// Continue the previous upload session, unless the content has been changed or the session is gone
+	var session *uploadSession
+	unchanged := state.Session != "" && state.FileName == fileName && state.Size == size
+	if unchanged {
+		if unchanged, err = state.matches(r); err != nil {
+			return nil, err
+		}
+	}
+	if unchanged {
+		session = &uploadSession{}
+		if err = getJSON(ctx, e, state.Session, session); IsNotFound(err) {
+			session = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if session == nil {
+		session, err = createUploadSession(ctx, e, f.Links.FileUploadResumable.Href, fileName, contentType, size)
+		if err != nil {
+			return nil, err
+		}
+		state.Chunks = nil
+	}
+	if session.ChunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d of upload session %s", session.ChunkSize, session.Links.Self.Href)
+	}
+
+	state.Session = session.Links.Self.Href
+	state.FileName = fileName
+	state.Size = size
+	state.ChunkSize = session.ChunkSize
+	if state.Chunks == nil {
+		state.Chunks = make(map[int]string)
+	}
+	if err = saveUploadState(stateFile, state); err != nil {
+		return nil, err
+	}
+
+	// Chunks are only skipped if the server has them and their checksum is known. Chunks which
+	// have been confirmed by the server just before an interruption are uploaded again.
+	confirmed := make(map[int]bool)
+	for _, i := range session.Chunks {
+		confirmed[i] = state.Chunks[i] != ""
+	}
+
+	// Confirmed chunks are read as well, since the checksums cover the whole content
+	h := newContentHash()
+	var done int64
+	buf := make([]byte, session.ChunkSize)
+	for offset, i := int64(0), 0; offset < size; offset, i = offset+session.ChunkSize, i+1 {
+		chunk := buf[:min64(session.ChunkSize, size-offset)]
+		if _, err = r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err = io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		h.Write(chunk)
+		if confirmed[i] {
+			done += int64(len(chunk))
+			continue
+		}
+
+		link := strings.Replace(session.Links.Chunk.Href, "{index}", strconv.Itoa(i), 1)
+		if err = uploadChunk(ctx, e, link, chunk, offset, size, done); err != nil {
+			return nil, err
+		}
+		done += int64(len(chunk))
+
+		state.Chunks[i] = chunkSum(chunk)
+		if err = saveUploadState(stateFile, state); err != nil {
+			return nil, err
+		}
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", session.Links.Complete.Href, nil)
+	resp, err := e.Execute(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	if err = checkResponse(resp); err != nil {
+		return nil, err
+	}
+	if err = removeFile(stateFile); err != nil {
+		return nil, err
+	}
+
+	result := &UploadResult{ProjectFile: f, Size: h.Size(), Checksums: h.Checksums()}
+	return result, verifyChecksums(resp.Header, result.Checksums, session.Links.Complete.Href, false)
+}
+
+// matches reports whether the chunks which have been uploaded before are still the same in r
+func (s *uploadState) matches(r io.ReadSeeker) (bool, error) {
+	if len(s.Chunks) > 0 && s.ChunkSize <= 0 {
+		return false, nil
+	}
+	buf := make([]byte, s.ChunkSize)
+	for i, sum := range s.Chunks {
+		offset := int64(i) * s.ChunkSize
+		if i < 0 || offset >= s.Size {
+			return false, nil
+		}
+		chunk := buf[:min64(s.ChunkSize, s.Size-offset)]
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return false, err
+		}
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return false, err
+		}
+		if chunkSum(chunk) != sum {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// chunkSum returns the hex encoded SHA-256 checksum of the chunk
+func chunkSum(chunk []byte) string {
+	sum := sha256.Sum256(chunk)
+	return hex.EncodeToString(sum[:])
+}
+
+// projectFileProjectID returns the ID of the project the project file belongs to
+func projectFileProjectID(ctx context.Context, e Executor, f *ProjectFile) (string, error) {
+	if f.Links == nil || f.Links.Project.Href == "" {
+		return "", fmt.Errorf("project file %s has no project link", f.ID)
+	}
+	var project Project
+	if err := getJSON(ctx, e, f.Links.Project.Href, &project); err != nil {
+		return "", err
+	}
+	return projectIDFromLink(project.Links.Self.Href), nil
+}
+
+// createUploadSession starts a new resumable upload
+func createUploadSession(ctx context.Context, e Executor, link string, fileName string, contentType string, size int64) (*uploadSession, error) {
+	b := new(bytes.Buffer)
+	json.NewEncoder(b).Encode(map[string]interface{}{
+		"fileName":    fileName,
+		"contentType": contentType,
+		"size":        size,
+		"chunkSize":   UploadChunkSize,
+	})
+
+	req, _ := http.NewRequestWithContext(ctx, "POST", link, b)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := e.Execute(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	if err = checkResponse(resp, http.StatusCreated); err != nil {
+		return nil, err
+	}
+
+	var session uploadSession
+	return &session, json.NewDecoder(resp.Body).Decode(&session)
+}
+
+// uploadChunk uploads a single chunk starting at offset. The number of bytes which have been
+// uploaded before is given by done and is used for the progress report.
+func uploadChunk(ctx context.Context, e Executor, link string, chunk []byte, offset, size, done int64) error {
+	req, _ := http.NewRequestWithContext(ctx, "PUT", link, nil)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(chunk))-1, size))
+
+	req.ContentLength = int64(len(chunk))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(newProgressReader(ctx, bytes.NewReader(chunk), done, size)), nil
+	}
+	req.Body, _ = req.GetBody()
+
+	resp, err := e.Execute(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+	}()
+	return checkResponse(resp)
+}
+
+// detectSeekerFileType detects the file type of the content of r, which is read from the beginning
+func detectSeekerFileType(fileName string, r io.ReadSeeker) (*FileType, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	fileType, _, err := detectFileType(fileName, r)
+	return fileType, err
+}
+
+// loadUploadState reads the state file, nil is returned if the file does not exist
+func loadUploadState(path string) (*uploadState, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state uploadState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// saveUploadState writes the state file. The file is replaced atomically, hence it is
+// not corrupted if the process crashes.
+func saveUploadState(path string, state *uploadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
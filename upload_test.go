@@ -0,0 +1,177 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/breiting/rex"
+	"github.com/breiting/rex/rextest"
+)
+
+// failChunk returns a middleware which fails the upload of the chunk with the given suffix
+// (e.g. /chunks/2) once, all chunk uploads are counted
+func failChunk(suffix string, puts *int) rex.Middleware {
+	failed := false
+	return func(next rex.Executor) rex.Executor {
+		return rex.ExecutorFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "PUT" {
+				*puts++
+				if !failed && strings.HasSuffix(req.URL.Path, suffix) {
+					failed = true
+					return nil, errors.New("connection reset")
+				}
+			}
+			return next.Execute(req)
+		})
+	}
+}
+
+// newResumableServer returns a server with resumable uploads using chunks of 16 bytes
+func newResumableServer(t *testing.T) (*rextest.Server, *rex.Client) {
+	t.Helper()
+	s, c := newTestClient(t, func(s *rextest.Server) { s.ResumableUploads = true })
+	chunkSize := rex.UploadChunkSize
+	rex.UploadChunkSize = 16
+	t.Cleanup(func() { rex.UploadChunkSize = chunkSize })
+	return s, c
+}
+
+func downloadContent(t *testing.T, c *rex.Client, f *rex.ProjectFile) string {
+	t.Helper()
+	var b bytes.Buffer
+	if _, err := rex.DownloadFileTo(c, f.Links.FileDownload.Href, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestUploadResumable(t *testing.T) {
+	_, c := newResumableServer(t)
+	p := newTestProject(t, c, "upload")
+
+	content := strings.Repeat("v 0 0 0\n", 12) // 6 chunks
+	state := filepath.Join(t.TempDir(), "upload.json")
+	var puts int
+	e := rex.Chain(c, failChunk("/chunks/3", &puts))
+	if err := rex.UploadProjectFileResumable(e, p.ID, "model", "model.obj", nil, strings.NewReader(content), state); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+
+	puts = 0
+	result, err := rex.UploadProjectFileResumableWithResult(e, p.ID, "model", "model.obj", nil, strings.NewReader(content), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puts != 3 {
+		t.Errorf("got %d chunk uploads, want the remaining 3", puts)
+	}
+	if got := downloadContent(t, c, result.ProjectFile); got != content {
+		t.Errorf("got content %q, want %q", got, content)
+	}
+	assertNotExist(t, state)
+}
+
+func TestUploadResumableChangedContent(t *testing.T) {
+	_, c := newResumableServer(t)
+	p := newTestProject(t, c, "upload")
+
+	state := filepath.Join(t.TempDir(), "upload.json")
+	var puts int
+	e := rex.Chain(c, failChunk("/chunks/3", &puts))
+	if err := rex.UploadProjectFileResumable(e, p.ID, "model", "model.obj", nil, strings.NewReader(strings.Repeat("v 0 0 0\n", 12)), state); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+
+	// The file has been edited in the meantime, the size is the same
+	changed := "v 1 1 1\n" + strings.Repeat("v 0 0 0\n", 11)
+	puts = 0
+	result, err := rex.UploadProjectFileResumableWithResult(e, p.ID, "model", "model.obj", nil, strings.NewReader(changed), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puts != 6 {
+		t.Errorf("got %d chunk uploads, want all 6", puts)
+	}
+	if got := downloadContent(t, c, result.ProjectFile); got != changed {
+		t.Errorf("got content %q, want %q", got, changed)
+	}
+}
+
+func TestUploadResumableOtherProject(t *testing.T) {
+	_, c := newResumableServer(t)
+	p1 := newTestProject(t, c, "first")
+	p2 := newTestProject(t, c, "second")
+
+	content := strings.Repeat("v 0 0 0\n", 12)
+	state := filepath.Join(t.TempDir(), "upload.json")
+	var puts int
+	e := rex.Chain(c, failChunk("/chunks/3", &puts))
+	if err := rex.UploadProjectFileResumable(e, p1.ID, "model", "model.obj", nil, strings.NewReader(content), state); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+
+	puts = 0
+	if err := rex.UploadProjectFileResumable(e, p2.ID, "model", "model.obj", nil, strings.NewReader(content), state); err == nil {
+		t.Fatal("upload of another project has been continued")
+	}
+	if puts != 0 {
+		t.Errorf("got %d chunk uploads, want none", puts)
+	}
+}
+
+func TestReplaceProjectFileContentResumable(t *testing.T) {
+	_, c := newResumableServer(t)
+	p := newTestProject(t, c, "upload")
+	f, err := rex.UploadProjectFileWithResult(c, p.ID, "model", "model.obj", nil, strings.NewReader("v 0 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := strings.Repeat("v 1 1 1\n", 12)
+	state := filepath.Join(t.TempDir(), "upload.json")
+	var puts int
+	e := rex.Chain(c, failChunk("/chunks/4", &puts))
+	if err := rex.ReplaceProjectFileContentResumable(e, f.ProjectFile.ID, "model.obj", strings.NewReader(content), state); err == nil {
+		t.Fatal("interrupted upload succeeded")
+	}
+	if err := rex.ReplaceProjectFileContentResumable(e, "4711", "model.obj", strings.NewReader(content), state); err == nil {
+		t.Error("upload of another project file has been continued")
+	}
+
+	puts = 0
+	if err := rex.ReplaceProjectFileContentResumable(e, f.ProjectFile.ID, "model.obj", strings.NewReader(content), state); err != nil {
+		t.Fatal(err)
+	}
+	if puts != 2 {
+		t.Errorf("got %d chunk uploads, want the remaining 2", puts)
+	}
+	if got := downloadContent(t, c, f.ProjectFile); got != content {
+		t.Errorf("got content %q, want %q", got, content)
+	}
+}
+
+func TestUploadResumableWithoutServerSupport(t *testing.T) {
+	_, c := newTestClient(t)
+	p := newTestProject(t, c, "upload")
+
+	content := strings.Repeat("v 0 0 0\n", 12)
+	state := filepath.Join(t.TempDir(), "upload.json")
+	var puts int
+	result, err := rex.UploadProjectFileResumableWithResult(rex.Chain(c, failChunk("/chunks/0", &puts)), p.ID, "model", "model.obj", nil, strings.NewReader(content), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if puts != 0 {
+		t.Errorf("got %d chunk uploads, want a single upload", puts)
+	}
+	if got := downloadContent(t, c, result.ProjectFile); got != content {
+		t.Errorf("got content %q, want %q", got, content)
+	}
+	assertNotExist(t, state)
+}
@@ -3,11 +3,13 @@
 package rex
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 
 	"github.com/tidwall/gjson"
 )
@@ -61,7 +63,16 @@ func (u User) String() string {
 // The current user is the one which has been identified by the authentication token.
 // When a new client is created by NewClient, this function will already be called implicitly.
 func GetCurrentUser(e Executor) (*User, error) {
-	req, _ := http.NewRequest("GET", RexBaseURL+apiCurrentUser, nil)
+	return GetCurrentUserContext(context.Background(), e)
+}
+
+// GetCurrentUserContext is like GetCurrentUser but uses the given context for the request.
+func GetCurrentUserContext(ctx context.Context, e Executor) (*User, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", base+apiCurrentUser, nil)
 
 	resp, err := e.Execute(req)
 	if err != nil {
@@ -70,6 +81,9 @@ func GetCurrentUser(e Executor) (*User, error) {
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 	}()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return nil, err
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -86,7 +100,16 @@ func GetCurrentUser(e Executor) (*User, error) {
 //
 // Requires admin permissions!
 func GetTotalNumberOfUsers(e Executor) (uint64, error) {
-	req, _ := http.NewRequest("GET", RexBaseURL+apiUsers, nil)
+	return GetTotalNumberOfUsersContext(context.Background(), e)
+}
+
+// GetTotalNumberOfUsersContext is like GetTotalNumberOfUsers but uses the given context for the request.
+func GetTotalNumberOfUsersContext(ctx context.Context, e Executor) (uint64, error) {
+	base, err := baseURL(e)
+	if err != nil {
+		return 0, err
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", base+apiUsers, nil)
 
 	resp, err := e.Execute(req)
 	if err != nil {
@@ -95,6 +118,9 @@ func GetTotalNumberOfUsers(e Executor) (uint64, error) {
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 	}()
+	if err = checkResponse(resp, http.StatusOK); err != nil {
+		return 0, err
+	}
 
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -104,10 +130,20 @@ func GetTotalNumberOfUsers(e Executor) (uint64, error) {
 	return gjson.Get(string(body), "page.totalElements").Uint(), nil
 }
 
-// GetUserByEmail retrieves the user information based on a given email address
+// GetUserByEmail retrieves the user information based on a given email address.
+// If there is no such user, an error wrapping ErrUserNotFound is returned.
 func GetUserByEmail(e Executor, email string) (*User, error) {
+	return GetUserByEmailContext(context.Background(), e, email)
+}
 
-	req, _ := http.NewRequest("GET", RexBaseURL+apiFindByEmail+email, nil)
+// GetUserByEmailContext is like GetUserByEmail but uses the given context for all requests.
+func GetUserByEmailContext(ctx context.Context, e Executor, email string) (*User, error) {
+
+	base, err := baseURL(e)
+	if err != nil {
+		return nil, err
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", base+apiFindByEmail+url.QueryEscape(email), nil)
 
 	r, err := e.Execute(req)
 	if err != nil {
@@ -116,15 +152,25 @@ func GetUserByEmail(e Executor, email string) (*User, error) {
 
 	// check if the user can be found
 	var user User
-	err = json.NewDecoder(r.Body).Decode(&user)
+	err = checkResponse(r, http.StatusOK)
+	if err == nil {
+		err = json.NewDecoder(r.Body).Decode(&user)
+	}
 	io.Copy(ioutil.Discard, r.Body)
 
-	if err != nil || user.UserID == "" {
-		return &User{}, fmt.Errorf("user not found")
+	// a 404 is wrapped, hence IsNotFound and errors.Is(err, ErrUserNotFound) hold both
+	if IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %s: %w", ErrUserNotFound, email, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.UserID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, email)
 	}
 
 	// Fetch actual user information based on the retrieved UserID
-	req, _ = http.NewRequest("GET", RexBaseURL+apiFindByID+user.UserID, nil)
+	req, _ = http.NewRequestWithContext(ctx, "GET", base+apiFindByID+url.QueryEscape(user.UserID), nil)
 	r, err = e.Execute(req)
 	if err != nil {
 		return nil, err
@@ -132,7 +178,10 @@ func GetUserByEmail(e Executor, email string) (*User, error) {
 	defer func() {
 		io.Copy(ioutil.Discard, r.Body)
 	}()
+	if err = checkResponse(r, http.StatusOK); err != nil {
+		return nil, err
+	}
 
 	err = json.NewDecoder(r.Body).Decode(&user)
-	return &user, nil
+	return &user, err
 }
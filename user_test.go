@@ -0,0 +1,57 @@
+// Copyright 2018 Bernhard Reitinger. All rights reserved.
+
+package rex_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/breiting/rex"
+	"github.com/breiting/rex/rextest"
+)
+
+func TestGetUserByEmail(t *testing.T) {
+	_, c := newTestClient(t)
+
+	u, err := rex.GetUserByEmail(c, "rextest@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.UserID != rextest.UserID {
+		t.Errorf("got user %q, want %q", u.UserID, rextest.UserID)
+	}
+
+	_, err = rex.GetUserByEmail(c, "unknown@example.com")
+	if !rex.IsNotFound(err) || !errors.Is(err, rex.ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want a not found error", err)
+	}
+}
+
+func TestGetUserByEmailEscaped(t *testing.T) {
+	s, c := newTestClient(t)
+	s.AddUser(rex.User{UserID: "team&co=1", Email: "first+last@example.com"}, "team-client-id", "team-client-secret")
+
+	// Both the email and the user ID contain characters which have to be escaped in a query
+	u, err := rex.GetUserByEmail(c, "first+last@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.UserID != "team&co=1" || u.Email != "first+last@example.com" {
+		t.Errorf("got user %q with email %q", u.UserID, u.Email)
+	}
+}
+
+func TestGetUserByEmailWithoutUserID(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	c := rex.NewClient(ts.Client(), rex.WithBaseURL(ts.URL))
+	_, err := rex.GetUserByEmail(c, "rextest@example.com")
+	if !errors.Is(err, rex.ErrUserNotFound) || rex.IsNotFound(err) {
+		t.Errorf("got %v, want ErrUserNotFound", err)
+	}
+}